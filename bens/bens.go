@@ -0,0 +1,204 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+// Package bens loads a bens environment into a Go program, replacing a call
+// to bens environment at startup:
+//
+//	values, err := bens.Load(bens.Options{Setenv: true})
+//
+// or, decoding into a struct:
+//
+//	var config struct {
+//		DatabaseURL string        `bens:"DATABASE_URL,required"`
+//		Timeout     time.Duration `bens:"TIMEOUT"`
+//	}
+//	err := bens.LoadInto(bens.Options{}, &config)
+package bens
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/highfidelity/bens/cnf"
+	"github.com/highfidelity/bens/key"
+)
+
+// Options says where Load finds the configuration and keys. The zero value
+// works like the bens command run from the working directory without flags.
+type Options struct {
+	// ConfigFiles are layered in order, later ones taking precedence. By
+	// default bens.yml is found the way the bens command finds it, by
+	// walking up from the working directory.
+	ConfigFiles []string
+
+	// PrivateKey, PublicKey and Pass provide the key material directly.
+	// When PrivateKey is nil, the private key is read from PrivateKeyFile.
+	// The public key isn't needed to decrypt.
+	PrivateKey io.Reader
+	PublicKey  io.Reader
+	Pass       []byte
+
+	// PassFile, PrivateKeyFile and PublicKeyFile default to pass.txt,
+	// pri.key and pub.key next to the configuration file that was found,
+	// or in the working directory when ConfigFiles is set.
+	PassFile       string
+	PrivateKeyFile string
+	PublicKeyFile  string
+
+	// Filter selects and renames the variables that are loaded. Only the
+	// selected variables and the ones they refer to are decrypted.
+	Filter cnf.Filter
+
+	// Setenv sets every variable in the process environment, except files.
+	Setenv bool
+}
+
+// withDefaults fills in the configuration and key files that weren't set.
+func (o Options) withDefaults() (Options, error) {
+	var root string
+	if len(o.ConfigFiles) == 0 {
+		var err error
+		if root, err = cnf.Find("."); err != nil {
+			return o, fmt.Errorf("couldn't look for %s: %v", cnf.FileName, err)
+		}
+		o.ConfigFiles = []string{filepath.Join(root, cnf.FileName)}
+	}
+	for _, f := range []struct {
+		path *string
+		name string
+	}{
+		{&o.PassFile, "pass.txt"},
+		{&o.PrivateKeyFile, "pri.key"},
+		{&o.PublicKeyFile, "pub.key"},
+	} {
+		if *f.path == "" {
+			*f.path = filepath.Join(root, f.name)
+		}
+	}
+	return o, nil
+}
+
+func readAllOrNil(r io.Reader) ([]byte, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return ioutil.ReadAll(r)
+}
+
+// keys loads the keys of key sets from the options.
+type keys struct {
+	options Options
+	pri     []byte
+	pub     []byte
+}
+
+func (k *keys) load(files cnf.KeyFiles) (key.Key, error) {
+	if files == (cnf.KeyFiles{}) && k.pri != nil {
+		return key.FromPEM(k.pri, k.pub, k.options.Pass)
+	}
+	return k.fromFiles(files.Inherit(cnf.KeyFiles{
+		PassFile:       k.options.PassFile,
+		PrivateKeyFile: k.options.PrivateKeyFile,
+		PublicKeyFile:  k.options.PublicKeyFile,
+	}))
+}
+
+func (k *keys) fromFiles(files cnf.KeyFiles) (key.Key, error) {
+	pri, err := ioutil.ReadFile(files.PrivateKeyFile)
+	if err != nil {
+		return key.Key{}, err
+	}
+	var pub []byte
+	if files.PublicKeyFile != "" {
+		if pub, err = ioutil.ReadFile(files.PublicKeyFile); err != nil && !os.IsNotExist(err) {
+			return key.Key{}, err
+		}
+	}
+	pass := k.options.Pass
+	if pass == nil {
+		if pass, err = ioutil.ReadFile(files.PassFile); err != nil {
+			return key.Key{}, err
+		}
+		pass = bytes.TrimSpace(pass)
+	}
+	return key.FromPEM(pri, pub, pass)
+}
+
+// Decrypt loads and decrypts the environment, in the order its variables
+// are defined. A key is only loaded once a selected value needs it.
+// Variables restricted to groups the key isn't a member of are returned as
+// Unreadable.
+func Decrypt(options Options) ([]cnf.EnvVar, error) {
+	options, err := options.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	k := keys{options: options}
+	if k.pri, err = readAllOrNil(options.PrivateKey); err != nil {
+		return nil, fmt.Errorf("couldn't read private key: %v", err)
+	}
+	if k.pub, err = readAllOrNil(options.PublicKey); err != nil {
+		return nil, fmt.Errorf("couldn't read public key: %v", err)
+	}
+
+	layers, err := cnf.Load(options.ConfigFiles...)
+	if err != nil {
+		return nil, err
+	}
+	ciphers := make(map[cnf.KeyFiles]*key.Lazy)
+	for i := range layers {
+		files := layers[i].Keys
+		cipher, ok := ciphers[files]
+		if !ok {
+			cipher = key.NewLazy(func() (key.Key, error) {
+				loaded, err := k.load(files)
+				if err != nil {
+					return key.Key{}, fmt.Errorf("couldn't load key: %w", err)
+				}
+				return loaded, nil
+			})
+			ciphers[files] = cipher
+		}
+		layers[i].Cnf.SetCipher(cipher)
+	}
+	return cnf.DecryptLayersMatching(layers, options.Filter)
+}
+
+// Load loads and decrypts the environment and returns it as a map of names
+// to values. Files added with bens add --file map to their content.
+// Variables the key can't read are left out.
+func Load(options Options) (map[string]string, error) {
+	environment, err := Decrypt(options)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(environment))
+	for _, envVar := range environment {
+		if envVar.Unreadable {
+			continue
+		}
+		values[envVar.Name] = envVar.Value
+		if options.Setenv && !envVar.File {
+			if err := os.Setenv(envVar.Name, envVar.Value); err != nil {
+				return nil, fmt.Errorf("couldn't set %s: %v", envVar.Name, err)
+			}
+		}
+	}
+	return values, nil
+}
+
+// LoadInto loads the environment like Load and decodes it into v, a pointer
+// to a struct, like Decode.
+func LoadInto(options Options, v interface{}) error {
+	values, err := Load(options)
+	if err != nil {
+		return err
+	}
+	return Decode(values, v)
+}
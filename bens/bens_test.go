@@ -0,0 +1,146 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package bens
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/highfidelity/bens/cnf"
+	"github.com/highfidelity/bens/key"
+)
+
+var pass = []byte("correct horse battery staple")
+
+// generateKey returns a new encrypted private key and its public key, both
+// PEM encoded.
+func generateKey(t *testing.T) ([]byte, []byte) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %v", err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY",
+		x509.MarshalPKCS1PrivateKey(private), pass, x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("couldn't encrypt key: %v", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("couldn't marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(block), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+}
+
+func writeConfig(t *testing.T, pub []byte) string {
+	k, err := key.FromPEM(nil, pub, nil)
+	if err != nil {
+		t.Fatalf("couldn't load public key: %v", err)
+	}
+	secret, err := k.Encrypt("s3cret")
+	if err != nil {
+		t.Fatalf("couldn't encrypt: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "bens")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	config := fmt.Sprintf(`version: 4
+environment:
+  - name: BENS_TEST_SECRET
+    encryptedValue: %s
+  - name: BENS_TEST_PORT
+    value: "8080"
+`, secret)
+	if err = ioutil.WriteFile(filepath.Join(dir, "bens.yml"), []byte(config), 0600); err != nil {
+		t.Fatalf("couldn't write config: %v", err)
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	pri, pub := generateKey(t)
+	dir := writeConfig(t, pub)
+	defer os.RemoveAll(dir)
+
+	values, err := Load(Options{
+		ConfigFiles: []string{filepath.Join(dir, "bens.yml")},
+		PrivateKey:  bytes.NewReader(pri),
+		Pass:        pass,
+		Setenv:      true,
+	})
+	if err != nil {
+		t.Fatalf("couldn't load: %v", err)
+	}
+	defer os.Unsetenv("BENS_TEST_SECRET")
+	defer os.Unsetenv("BENS_TEST_PORT")
+	if values["BENS_TEST_SECRET"] != "s3cret" || values["BENS_TEST_PORT"] != "8080" {
+		t.Fatalf("unexpected values: %v", values)
+	}
+	if os.Getenv("BENS_TEST_SECRET") != "s3cret" {
+		t.Fatal("Setenv should set the variables")
+	}
+}
+
+func TestLoadIntoFromKeyFiles(t *testing.T) {
+	pri, pub := generateKey(t)
+	dir := writeConfig(t, pub)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "pri.key"), pri, 0600); err != nil {
+		t.Fatalf("couldn't write key: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pass.txt"), append(pass, '\n'), 0600); err != nil {
+		t.Fatalf("couldn't write pass: %v", err)
+	}
+
+	var config struct {
+		Secret string `bens:"BENS_TEST_SECRET,required"`
+		Port   int    `bens:"BENS_TEST_PORT"`
+	}
+	err := LoadInto(Options{
+		ConfigFiles:    []string{filepath.Join(dir, "bens.yml")},
+		PassFile:       filepath.Join(dir, "pass.txt"),
+		PrivateKeyFile: filepath.Join(dir, "pri.key"),
+	}, &config)
+	if err != nil {
+		t.Fatalf("couldn't load: %v", err)
+	}
+	if config.Secret != "s3cret" || config.Port != 8080 {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+	if _, ok := os.LookupEnv("BENS_TEST_SECRET"); ok {
+		t.Fatal("variables shouldn't be set without Setenv")
+	}
+}
+
+func TestDecryptFilteredWithoutKey(t *testing.T) {
+	_, pub := generateKey(t)
+	dir := writeConfig(t, pub)
+	defer os.RemoveAll(dir)
+
+	// There is no private key, but the selected value doesn't need one.
+	environment, err := Decrypt(Options{
+		ConfigFiles: []string{filepath.Join(dir, "bens.yml")},
+		Filter:      cnf.Filter{Only: []string{"BENS_TEST_PORT"}},
+	})
+	if err != nil {
+		t.Fatalf("couldn't decrypt: %v", err)
+	}
+	if len(environment) != 1 || environment[0].Value != "8080" {
+		t.Fatalf("unexpected environment: %v", environment)
+	}
+	if _, err = Decrypt(Options{ConfigFiles: []string{filepath.Join(dir, "bens.yml")}}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the missing key to be reported; got %v", err)
+	}
+}
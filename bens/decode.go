@@ -0,0 +1,131 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package bens
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decode stores values in the fields of v, a pointer to a struct, that are
+// tagged with the name of a variable:
+//
+//	Field string `bens:"NAME"`
+//	Other int    `bens:"OTHER,required"`
+//
+// Decoding fails if a required variable isn't defined. Other fields keep
+// their value when their variable isn't defined. Fields can be strings,
+// []byte, booleans, integers, floats, time.Duration, []string, from a comma
+// separated list, or implement encoding.TextUnmarshaler.
+func Decode(values map[string]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("can only decode into a pointer to a struct, not %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("bens")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		required := false
+		for _, option := range parts[1:] {
+			if option != "required" {
+				return fmt.Errorf("unknown option %q for %s", option, field.Name)
+			}
+			required = true
+		}
+		value, ok := values[name]
+		if !ok {
+			if required {
+				return fmt.Errorf("%s is required by %s but isn't defined", name, field.Name)
+			}
+			continue
+		}
+		if !rv.Field(i).CanSet() {
+			return fmt.Errorf("can't set unexported field %s", field.Name)
+		}
+		if err := set(rv.Field(i), value); err != nil {
+			return fmt.Errorf("couldn't decode %s into %s: %v", name, field.Name, err)
+		}
+	}
+	return nil
+}
+
+func set(field reflect.Value, value string) error {
+	if field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		switch field.Type().Elem().Kind() {
+		case reflect.Uint8:
+			field.SetBytes([]byte(value))
+		case reflect.String:
+			var items []string
+			if value != "" {
+				items = strings.Split(value, ",")
+				for i := range items {
+					items[i] = strings.TrimSpace(items[i])
+				}
+			}
+			field.Set(reflect.ValueOf(items).Convert(field.Type()))
+		default:
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
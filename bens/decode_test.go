@@ -0,0 +1,76 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package bens
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	var config struct {
+		URL      string        `bens:"DATABASE_URL,required"`
+		Port     int           `bens:"PORT"`
+		Debug    bool          `bens:"DEBUG"`
+		Ratio    float64       `bens:"RATIO"`
+		Timeout  time.Duration `bens:"TIMEOUT"`
+		Hosts    []string      `bens:"HOSTS"`
+		Cert     []byte        `bens:"CERT"`
+		IP       net.IP        `bens:"IP"`
+		Missing  string        `bens:"MISSING"`
+		Untagged string
+	}
+	config.Missing = "kept"
+	err := Decode(map[string]string{
+		"DATABASE_URL": "postgres://db/app",
+		"PORT":         "5432",
+		"DEBUG":        "true",
+		"RATIO":        "0.5",
+		"TIMEOUT":      "1m30s",
+		"HOSTS":        "a, b,c",
+		"CERT":         "\x00\x01",
+		"IP":           "10.0.0.1",
+		"Untagged":     "ignored",
+	}, &config)
+	if err != nil {
+		t.Fatalf("couldn't decode: %v", err)
+	}
+	if config.URL != "postgres://db/app" || config.Port != 5432 || !config.Debug || config.Ratio != 0.5 {
+		t.Fatalf("unexpected scalars: %+v", config)
+	}
+	if config.Timeout != 90*time.Second || !reflect.DeepEqual(config.Hosts, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected duration or list: %+v", config)
+	}
+	if string(config.Cert) != "\x00\x01" || !config.IP.Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("unexpected bytes or text unmarshaler: %+v", config)
+	}
+	if config.Missing != "kept" || config.Untagged != "" {
+		t.Fatalf("undefined and untagged fields should be left alone: %+v", config)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var required struct {
+		URL string `bens:"DATABASE_URL,required"`
+	}
+	if err := Decode(map[string]string{}, &required); err == nil || !strings.Contains(err.Error(), "DATABASE_URL is required") {
+		t.Fatalf("expected a required error, got %v", err)
+	}
+
+	var port struct {
+		Port uint8 `bens:"PORT"`
+	}
+	if err := Decode(map[string]string{"PORT": "300"}, &port); err == nil {
+		t.Fatal("300 shouldn't fit a uint8")
+	}
+
+	if err := Decode(map[string]string{}, required); err == nil {
+		t.Fatal("decoding into a struct that isn't a pointer should fail")
+	}
+}
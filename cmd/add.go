@@ -7,7 +7,10 @@ package cmd
 
 import (
 	"errors"
-	"log"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -15,48 +18,200 @@ import (
 	"github.com/highfidelity/bens/key"
 )
 
+var description, owner, expires string
+var isTemplate, shouldInterpolate, isPlain, isFile bool
+var groups []string
+
 func init() {
 	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(setCmd)
+	addCmd.Flags().BoolVarP(&isPlain, "plain", "", false,
+		"store a value that isn't secret as plaintext; doesn't need the public key")
+	addCmd.Flags().BoolVarP(&isTemplate, "template", "", false,
+		"store the value as a plaintext template that refers to other variables as ${NAME}")
+	addCmd.Flags().BoolVarP(&shouldInterpolate, "interpolate", "", false,
+		"encrypt the value but expand ${NAME} references in it like a template")
+	addCmd.Flags().StringSliceVarP(&groups, "group", "", nil,
+		"encrypt the value only for the recipients in these comma separated groups; doesn't need the public key")
+	for _, c := range []*cobra.Command{addCmd, setCmd} {
+		c.Flags().BoolVarP(&isFile, "file", "", false,
+			"ENV_VALUE is the path of a file to store; exec sets ENV_NAME to the path of a copy")
+		c.Flags().StringVarP(&description, "description", "", "", "what the variable is for")
+		c.Flags().StringVarP(&owner, "owner", "", "", "who is responsible for the variable (default the current user)")
+		c.Flags().StringVarP(&expires, "expires", "", "",
+			"when the value expires, as a date (2006-01-02), a time (RFC 3339) or an age such as 90d")
+		c.Flags().BoolVarP(&shouldForce, "force", "f", false,
+			"encrypt with the public key even if other values were encrypted for another key")
+	}
+}
+
+func envNameAndValueArgs(cmd *cobra.Command, args []string) error {
+	l := len(args)
+	if l == 0 {
+		return errors.New("supply the ENV_NAME and ENV_VALUE arguments")
+	} else if l == 1 {
+		return errors.New("supply the ENV_VALUE argument")
+	} else if l > 2 {
+		return errors.New("too many arguments supplied")
+	}
+	return nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// updateMetadata applies the metadata flags to the variable name. A new
+// variable is owned by the current user unless --owner is given.
+func updateMetadata(cmd *cobra.Command, c *cnf.Cnf, name string) error {
+	var expiry time.Time
+	if cmd.Flags().Changed("expires") {
+		var err error
+		if expiry, err = parseTimeOrAge(expires); err != nil {
+			return err
+		}
+	}
+	return c.UpdateMetadata(name, func(m *cnf.Metadata) {
+		if cmd.Flags().Changed("description") {
+			m.Description = description
+		}
+		if cmd.Flags().Changed("owner") {
+			m.Owner = owner
+		} else if m.Owner == "" {
+			m.Owner = currentUser()
+		}
+		if cmd.Flags().Changed("expires") {
+			m.Expires = expiry
+		}
+	})
+}
+
+// fileValue returns the content of the file at path for --file.
+func fileValue(path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatalf("couldn't read %s: %v", path, err)
+	}
+	return string(content)
+}
+
+// storeVariable stores value with add or set while holding the
+// configuration file's lock. The public key is loaded if encrypt is set, and
+// must be the one the other values were encrypted for unless --force is
+// given.
+func storeVariable(cmd *cobra.Command, name, value string, encrypt bool, store func(*cnf.Cnf, string, string) error) {
+	storeVariableIf(cmd, name, value, func(*cnf.Cnf) bool { return encrypt }, store)
+}
+
+// storeVariableIf stores value like storeVariable, but loads the public key
+// only if encrypt returns true for the loaded configuration.
+func storeVariableIf(cmd *cobra.Command, name, value string, encrypt func(*cnf.Cnf) bool, store func(*cnf.Cnf, string, string) error) {
+	lock, err := cnf.LockFile(yamlPath)
+	if err != nil {
+		fatalf("couldn't lock %s: %v", yamlPath, err)
+	}
+	defer lock.Unlock()
+
+	c, err := cnf.New(yamlPath, nil)
+	if err != nil {
+		fatalf("couldn't load yaml %s: %v", yamlPath, err)
+	}
+
+	if encrypt(&c) {
+		// Encrypting only needs the public key, so the pass and
+		// private key are ignored even if specified.
+		cipher, err := key.New("", "", pubKeyPath)
+		if err != nil {
+			fatalf("couldn't load key: %v", err)
+		}
+		c.SetCipher(cipher)
+		if err = c.CheckKey(name); err != nil && !shouldForce {
+			fatalf("couldn't add %s: %v; use --force to add it anyway", name, err)
+		}
+	}
+
+	if err = store(&c, name, value); err != nil {
+		fatalf("couldn't add environment variable: %v", err)
+	}
+	if err = updateMetadata(cmd, &c, name); err != nil {
+		fatalf("couldn't update metadata: %v", err)
+	}
+	if err = c.Save(yamlPath); err != nil {
+		fatalf("couldn't save yaml to %s: %v", yamlPath, err)
+	}
 }
 
 var addCmd = &cobra.Command{
 	Use:   "add ENV_NAME ENV_VALUE",
 	Short: "Add an encrypted environment variable to the environment",
-	Args: func(cmd *cobra.Command, args []string) error {
-		l := len(args)
-		if l == 0 {
-			return errors.New("supply the ENV_NAME and ENV_VALUE arguments")
-		} else if l == 1 {
-			return errors.New("supply the ENV_VALUE argument")
-		} else if l > 2 {
-			return errors.New("too many arguments supplied")
-		}
-		return nil
-	},
+	Args:  envNameAndValueArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		envName := args[0]
-		envValue := args[1]
-
-		// We don't use them so ignore them if specified.
-		passPath = ""
-		priKeyPath = ""
-
-		cipher, err := key.New(passPath, priKeyPath, pubKeyPath)
-		if err != nil {
-			log.Fatalf("couldn't load key: %v", err)
-			return
+		kinds := 0
+		for _, set := range []bool{isPlain, isTemplate, shouldInterpolate, isFile} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds > 1 {
+			fatalf("only one of --plain, --template, --interpolate and --file can be used")
+		}
+		if groups != nil && (isPlain || isTemplate || shouldInterpolate) {
+			fatalf("--group can't be used with --plain, --template or --interpolate")
 		}
 
-		cnf, err := cnf.New(yamlPath, cipher)
-		if err != nil {
-			log.Fatalf("couldn't load yaml %s: %v", yamlPath, err)
+		switch {
+		case groups != nil && isFile:
+			storeVariable(cmd, args[0], fileValue(args[1]), false, func(c *cnf.Cnf, name, value string) error {
+				return c.AddFileForGroups(name, []byte(value), groups)
+			})
+		case groups != nil:
+			storeVariable(cmd, args[0], args[1], false, func(c *cnf.Cnf, name, value string) error {
+				return c.AddForGroups(name, value, groups)
+			})
+		case isFile:
+			storeVariable(cmd, args[0], fileValue(args[1]), true, func(c *cnf.Cnf, name, value string) error {
+				return c.AddFile(name, []byte(value))
+			})
+		case isPlain:
+			storeVariable(cmd, args[0], args[1], false, (*cnf.Cnf).AddPlain)
+		case isTemplate:
+			storeVariable(cmd, args[0], args[1], false, func(c *cnf.Cnf, name, value string) error {
+				return c.AddTemplate(name, value, false)
+			})
+		case shouldInterpolate:
+			storeVariable(cmd, args[0], args[1], true, func(c *cnf.Cnf, name, value string) error {
+				return c.AddTemplate(name, value, true)
+			})
+		default:
+			storeVariable(cmd, args[0], args[1], true, (*cnf.Cnf).Add)
 		}
+	},
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set ENV_NAME ENV_VALUE",
+	Short: "Replace the value of an environment variable, recording the rotation",
+	Long: `Replace the value of an environment variable, recording the rotation.
 
-		if err = cnf.Add(envName, envValue); err != nil {
-			log.Fatalf("couldn't add environment variable: %v", err)
+The variable is added if it doesn't exist yet. The public key is only needed
+to replace an encrypted value or add a new one.`,
+	Args: envNameAndValueArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		encrypt := func(c *cnf.Cnf) bool {
+			return c.SetEncrypts(args[0])
 		}
-		if err = cnf.Save(yamlPath); err != nil {
-			log.Fatalf("couldn't save yaml to %s: %v", yamlPath, err)
+		if !isFile {
+			storeVariableIf(cmd, args[0], args[1], encrypt, (*cnf.Cnf).Set)
+			return
 		}
+		storeVariableIf(cmd, args[0], fileValue(args[1]), encrypt, func(c *cnf.Cnf, name, value string) error {
+			return c.SetFile(name, []byte(value))
+		})
 	},
 }
@@ -0,0 +1,168 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// projectConfigName is the name of the project configuration file, found
+// in the working directory or its parents.
+const projectConfigName = ".bensrc"
+
+// pathFlags are the flags whose relative values in a configuration file are
+// relative to the file's directory.
+var pathFlags = map[string]bool{
+	"config-file":      true,
+	"pass-file":        true,
+	"private-key-file": true,
+	"public-key-file":  true,
+	"pkcs11-module":    true,
+}
+
+// envName returns the environment variable that sets the flag name.
+func envName(name string) string {
+	return "BENS_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// userConfigPath returns the path of the user's configuration file,
+// $XDG_CONFIG_HOME/bens/config.yml or ~/.config/bens/config.yml.
+func userConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "bens", "config.yml")
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		if u, err := user.Current(); err == nil {
+			home = u.HomeDir
+		}
+	}
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".config", "bens", "config.yml")
+}
+
+// projectConfigPath returns the path of the nearest .bensrc in the working
+// directory or its parents, or "" if there is none.
+func projectConfigPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readSettings reads a configuration file of flag names and values. A value
+// is a string, number or boolean or, for flags that can be repeated, a list
+// of them. A missing file has no settings.
+func readSettings(flags *pflag.FlagSet, path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	settings := make(map[string][]string, len(raw))
+	for name, value := range raw {
+		if flags.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown setting %s", name)
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case string, int, float64, bool:
+				settings[name] = append(settings[name], fmt.Sprint(v))
+			default:
+				return nil, fmt.Errorf("%s must be a value or a list of values", name)
+			}
+		}
+	}
+	return settings, nil
+}
+
+// setFlag sets the flag name to values unless it was already set, and
+// records where the values came from. Relative values of path flags are made
+// relative to dir.
+func setFlag(flags *pflag.FlagSet, name string, values []string, dir, origin string) error {
+	if flags.Changed(name) || len(values) == 0 {
+		return nil
+	}
+	for _, value := range values {
+		if pathFlags[name] && value != "" && !filepath.IsAbs(value) && dir != "" {
+			value = filepath.Join(dir, value)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s from %s: %v", name, origin, err)
+		}
+	}
+	pathOrigins[name] = origin
+	return nil
+}
+
+// applySettings sets the flags that weren't given on the command line from,
+// in order of precedence, BENS_* environment variables, the project's
+// .bensrc and the user's configuration file. A BENS_* variable for a flag
+// that can be repeated holds a list separated like $PATH.
+func applySettings(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		values := []string{value}
+		if f.Value.Type() == "stringArray" {
+			values = filepath.SplitList(value)
+		}
+		err = setFlag(flags, f.Name, values, "", "environment "+envName(f.Name))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{projectConfigPath(), userConfigPath()} {
+		if path == "" {
+			continue
+		}
+		settings, err := readSettings(flags, path)
+		if err != nil {
+			return fmt.Errorf("couldn't read %s: %v", path, err)
+		}
+		for name, values := range settings {
+			if err = setFlag(flags, name, values, filepath.Dir(path), path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
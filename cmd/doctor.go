@@ -0,0 +1,216 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+	"github.com/highfidelity/bens/key"
+)
+
+var doctorFormat string
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVarP(
+		&shouldAskPass, "ask-pass", "", false, "ask for pass")
+	doctorCmd.Flags().StringVarP(
+		&doctorFormat, "format", "", "text", "choices are: text and json")
+}
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type check struct {
+	Status string `json:"status"`
+	Check  string `json:"check"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type report struct {
+	OK     bool    `json:"ok"`
+	Checks []check `json:"checks"`
+}
+
+func (r *report) add(status, name, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, check{Status: status, Check: name, Detail: fmt.Sprintf(format, args...)})
+	if status == checkFail {
+		r.OK = false
+	}
+}
+
+// checkFile checks that path exists and, if private is set, that only its
+// owner can read it. A missing file is reported with status.
+func (r *report) checkFile(name, path string, private bool, status string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		r.add(status, name, "%v", err)
+		return false
+	}
+	if private {
+		if problem := permissionProblem(info); problem != "" {
+			r.add(checkWarn, name, "%s %s", path, problem)
+			return true
+		}
+	}
+	r.add(checkOK, name, "%s", path)
+	return true
+}
+
+// checkKey checks the files of a key set and loads it. It returns nil if the
+// key can't be used to decrypt. Problems with a key set that no layer needs
+// to decrypt are only warnings.
+func (r *report) checkKey(files cnf.KeyFiles, needed bool) *key.Key {
+	files = files.Inherit(cnf.KeyFiles{PassFile: passPath, PrivateKeyFile: priKeyPath, PublicKeyFile: pubKeyPath})
+	status := checkFail
+	if !needed {
+		status = checkWarn
+	}
+	if pkcs11Module != "" {
+		return r.checkToken(files, status)
+	}
+	ok := true
+	if !shouldAskPass && os.Getenv("BENS_PASS") == "" {
+		ok = r.checkFile("pass file", files.PassFile, true, status) && ok
+	}
+	ok = r.checkFile("private key", files.PrivateKeyFile, true, status) && ok
+	ok = r.checkFile("public key", files.PublicKeyFile, false, status) && ok
+	if !ok {
+		return nil
+	}
+
+	k, err := loadKeyFiles(files)
+	if err != nil {
+		r.add(status, "key "+files.PrivateKeyFile, "%v", err)
+		return nil
+	}
+	if err = k.VerifyPair(); err != nil {
+		r.add(status, "key pair", "%s and %s: %v", files.PrivateKeyFile, files.PublicKeyFile, err)
+		return nil
+	}
+	r.add(checkOK, "key pair", "%s matches %s, %s", files.PublicKeyFile, files.PrivateKeyFile, k.Fingerprint())
+	return &k
+}
+
+// checkToken opens the key on the PKCS#11 token and checks that the public
+// key file, which add encrypts with, belongs to it.
+func (r *report) checkToken(files cnf.KeyFiles, status string) *key.Key {
+	name := fmt.Sprintf("token slot %d", pkcs11Slot)
+	k, err := loadKeyFiles(files)
+	if err != nil {
+		r.add(status, name, "%s: %v", pkcs11Module, err)
+		return nil
+	}
+	r.add(checkOK, name, "%s, %s", pkcs11Module, k.Fingerprint())
+	if pub, err := key.NewWithPass(nil, "", files.PublicKeyFile); err != nil {
+		r.add(checkWarn, "public key", "%s: %v", files.PublicKeyFile, err)
+	} else if pub.Fingerprint() != k.Fingerprint() {
+		r.add(status, "public key", "%s is %s, which the token can't decrypt", files.PublicKeyFile, pub.Fingerprint())
+	} else {
+		r.add(checkOK, "public key", "%s matches the token", files.PublicKeyFile)
+	}
+	return &k
+}
+
+func runDoctor() report {
+	r := report{OK: true}
+	layers, err := cnf.Load(yamlPaths...)
+	if err != nil {
+		r.add(checkFail, "config", "%v", err)
+		return r
+	}
+	for _, layer := range layers {
+		r.add(checkOK, "config "+layer.Path, "version %d", layer.Cnf.FileVersion())
+	}
+
+	// Check the key set chosen on the command line even if nothing needs it
+	// to decrypt, since add needs its public key.
+	needed := make(map[cnf.KeyFiles]bool)
+	for _, layer := range layers {
+		if layer.Cnf.Encrypted() {
+			needed[layer.Keys] = true
+		}
+	}
+	keys := map[cnf.KeyFiles]*key.Key{{}: r.checkKey(cnf.KeyFiles{}, needed[cnf.KeyFiles{}])}
+	for i, layer := range layers {
+		if !layer.Cnf.Encrypted() {
+			continue
+		}
+		k, ok := keys[layer.Keys]
+		if !ok {
+			k = r.checkKey(layer.Keys, true)
+			keys[layer.Keys] = k
+		}
+		if k == nil {
+			r.add(checkFail, "variables in "+layer.Path, "not checked without a working key")
+			continue
+		}
+		layers[i].Cnf.SetCipher(k)
+	}
+
+	failed := make(map[string]bool)
+	for _, p := range cnf.CheckLayers(layers) {
+		status := checkFail
+		if p.Warning {
+			status = checkWarn
+		} else {
+			failed[p.Source] = true
+		}
+		name := "templates"
+		if p.Name != "" {
+			name = "variable " + p.Name + " in " + p.Source
+		}
+		r.add(status, name, "%v", p.Err)
+	}
+	for _, layer := range layers {
+		if !failed[layer.Path] && (!layer.Cnf.Encrypted() || keys[layer.Keys] != nil) {
+			r.add(checkOK, "variables in "+layer.Path, "%d variables decrypt", len(layer.Cnf.Names()))
+		}
+	}
+	return r
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration, keys and values for problems",
+	Long: `Check the configuration, keys and values for problems.
+
+doctor checks that the configuration and key files exist, that the private
+key and pass file can't be read by other users, that the pass decrypts the
+private key and the public key belongs to it, and that every value decrypts,
+without printing any. Duplicate and invalid variable names are reported too.
+Problems with key files no encrypted value needs are only warnings. doctor
+exits with status 9 if any check fails.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		r := runDoctor()
+		switch doctorFormat {
+		case "json":
+			out, err := json.MarshalIndent(r, "", "  ")
+			if err != nil {
+				fatalf("couldn't format report: %v", err)
+			}
+			fmt.Println(string(out))
+		case "text":
+			for _, c := range r.Checks {
+				fmt.Printf("%-4s  %s: %s\n", c.Status, c.Check, c.Detail)
+			}
+		default:
+			fatalf("unknown format %s; choices are: text and json", doctorFormat)
+		}
+		if !r.OK {
+			os.Exit(exitFindings)
+		}
+	},
+}
@@ -0,0 +1,20 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// permissionProblem describes what is wrong with the permissions of a file
+// that only its owner should read, or returns "".
+func permissionProblem(info os.FileInfo) string {
+	if perm := info.Mode().Perm(); perm&0044 != 0 {
+		return fmt.Sprintf("readable by group or others (mode %04o); run chmod 600", perm)
+	}
+	return ""
+}
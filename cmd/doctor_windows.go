@@ -0,0 +1,15 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import "os"
+
+// permissionProblem describes what is wrong with the permissions of a file
+// that only its owner should read, or returns "". Windows file modes don't
+// reflect ACLs, so nothing is checked.
+func permissionProblem(_ os.FileInfo) string {
+	return ""
+}
@@ -6,8 +6,9 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
 	"syscall"
 
@@ -19,8 +20,8 @@ import (
 	"github.com/highfidelity/bens/key"
 )
 
-func readPassFromTerm() ([]byte, error) {
-	fmt.Printf("password: ")
+func readPassFromTerm(prompt string) ([]byte, error) {
+	fmt.Printf("%s: ", prompt)
 	pass, err := terminal.ReadPassword(int(syscall.Stdin))
 	if err != nil {
 		return nil, err
@@ -29,55 +30,222 @@ func readPassFromTerm() ([]byte, error) {
 	return pass, nil
 }
 
+var pkcs11Module, pkcs11Label string
+var pkcs11Slot uint
+
+// tokenKey is the key on the PKCS#11 token, opened on first use.
+var tokenKey *key.Key
+
+// loadTokenKey opens the key on the PKCS#11 token. The PIN is taken like the
+// pass of a private key file.
+func loadTokenKey(files cnf.KeyFiles) (key.Key, error) {
+	if tokenKey != nil {
+		return *tokenKey, nil
+	}
+	var pin []byte
+	var err error
+	if shouldAskPass {
+		if pin, err = readPassFromTerm("PIN"); err != nil {
+			return key.Key{}, fmt.Errorf("couldn't read PIN from terminal: %v", err)
+		}
+	} else if pass := os.Getenv("BENS_PASS"); pass != "" {
+		pin = []byte(pass)
+	} else {
+		if pin, err = ioutil.ReadFile(files.PassFile); err != nil {
+			return key.Key{}, fmt.Errorf("couldn't read PIN: %w", err)
+		}
+		pin = bytes.TrimSpace(pin)
+	}
+	k, err := key.OpenPKCS11(key.PKCS11Options{Module: pkcs11Module, Slot: pkcs11Slot, PIN: pin, Label: pkcs11Label})
+	if err != nil {
+		return key.Key{}, err
+	}
+	tokenKey = &k
+	return k, nil
+}
+
+// loadKey loads the private key chosen on the command line.
+func loadKey() (key.Key, error) {
+	return loadKeyFiles(cnf.KeyFiles{})
+}
+
+// loadKeyFiles loads the private key in files, using the key files chosen on
+// the command line for the ones that aren't set. The pass is taken from the
+// terminal when --ask-pass is given, then from $BENS_PASS and finally from
+// the pass file. Under unlock, the key recovered from shares is used for
+// every file instead, and with --pkcs11-module the key on the token.
+func loadKeyFiles(files cnf.KeyFiles) (key.Key, error) {
+	if unlockedKey != nil {
+		return *unlockedKey, nil
+	}
+	defaults := cnf.KeyFiles{PassFile: passPath, PrivateKeyFile: priKeyPath, PublicKeyFile: pubKeyPath}
+	files = files.Inherit(defaults)
+	if pkcs11Module != "" {
+		return loadTokenKey(files)
+	}
+	if shouldAskPass {
+		prompt := "password"
+		if files.PrivateKeyFile != priKeyPath {
+			prompt = "password for " + files.PrivateKeyFile
+		}
+		pass, err := readPassFromTerm(prompt)
+		if err != nil {
+			return key.Key{}, fmt.Errorf("couldn't read pass from terminal: %v", err)
+		}
+		return key.NewWithPass(pass, files.PrivateKeyFile, files.PublicKeyFile)
+	}
+	pass := os.Getenv("BENS_PASS")
+	if pass != "" {
+		return key.NewWithPass([]byte(pass), files.PrivateKeyFile, files.PublicKeyFile)
+	}
+	return key.New(files.PassFile, files.PrivateKeyFile, files.PublicKeyFile)
+}
+
+// loadLayers loads the configuration files and the files they include.
+func loadLayers() []cnf.Layer {
+	layers, err := cnf.Load(yamlPaths...)
+	if err != nil {
+		fatalf("couldn't load yaml: %v", err)
+	}
+	return layers
+}
+
+// decryptEnvironment loads the configuration files and decrypts them, each
+// with its own key set.
+func decryptEnvironment() []cnf.EnvVar {
+	return decryptEnvironmentMatching(cnf.Filter{})
+}
+
+// decryptEnvironmentMatching decrypts the variables that f selects, and the
+// ones they refer to, like decryptEnvironment. Keys are only loaded when one
+// of those variables is encrypted with them. Variables that the key can't
+// read are left out with a warning.
+func decryptEnvironmentMatching(f cnf.Filter) []cnf.EnvVar {
+	layers := loadLayers()
+	keys := make(map[cnf.KeyFiles]*key.Lazy)
+	for i := range layers {
+		cipher, ok := keys[layers[i].Keys]
+		if !ok {
+			files := layers[i].Keys
+			cipher = key.NewLazy(func() (key.Key, error) {
+				k, err := loadKeyFiles(files)
+				if err != nil {
+					return key.Key{}, fmt.Errorf("couldn't read key: %w", err)
+				}
+				return k, nil
+			})
+			keys[layers[i].Keys] = cipher
+		}
+		layers[i].Cnf.SetCipher(cipher)
+	}
+	environment, err := cnf.DecryptLayersMatching(layers, f)
+	if err != nil {
+		fatalf("couldn't decrypt environment: %v", err)
+	}
+	readable := environment[:0]
+	for _, envVar := range environment {
+		if envVar.Unreadable {
+			fmt.Fprintf(os.Stderr, "skipping %s: your key isn't a recipient\n", envVar.Name)
+			continue
+		}
+		readable = append(readable, envVar)
+	}
+	return readable
+}
+
+func appendToFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 var serializerType string
 var shouldAskPass bool
+var shouldUnset bool
 
 func init() {
 	rootCmd.AddCommand(environmentCmd)
 	environmentCmd.PersistentFlags().StringVarP(
 		&serializerType,
-		"formatter", "", "shell", "choices are: shell, powershell and cmd")
+		"formatter", "", "shell",
+		"choices are: shell, powershell, cmd, fish, dotenv, docker, systemd, json, github and gitlab")
 	environmentCmd.PersistentFlags().BoolVarP(
 		&shouldAskPass, "ask-pass", "", false, "ask for pass")
+	environmentCmd.PersistentFlags().BoolVarP(
+		&shouldUnset, "unset", "", false,
+		"print commands that unset every variable instead; doesn't need the private key")
+	addFilterFlags(environmentCmd.PersistentFlags())
+}
+
+func printUnsetEnvironment() {
+	unsetter, err := env.GetUnsetter(serializerType)
+	if err != nil {
+		fatalf("couldn't load formatter: %v", err)
+	}
+	if err = filter.Validate(); err != nil {
+		fatalf("couldn't filter environment: %v", err)
+	}
+	for _, source := range cnf.Sources(loadLayers()) {
+		if filter.Match(source.Name) {
+			fmt.Println(unsetter.UnsetString(filter.Rename(source.Name)))
+		}
+	}
 }
 
 var environmentCmd = &cobra.Command{
 	Use:   "environment",
 	Short: "Decrypt and display the environment",
 	Run: func(cmd *cobra.Command, args []string) {
-		serializer, err := env.GetSerializer(serializerType)
-		if err != nil {
-			log.Fatalf("couldn't load serializer: %v", err)
+		if shouldUnset {
+			printUnsetEnvironment()
+			return
 		}
 
-		var cipher key.Key
-		if shouldAskPass {
-			pass, err := readPassFromTerm()
-			if err != nil {
-				log.Fatalf("couldn't read pass from terminal: %v", err)
-			}
-			cipher, err = key.NewWithPass(pass, priKeyPath, pubKeyPath)
-		} else {
-			pass := os.Getenv("BENS_PASS")
-			if pass != "" {
-				cipher, err = key.NewWithPass([]byte(pass), priKeyPath, pubKeyPath)
-			} else {
-				cipher, err = key.New(passPath, priKeyPath, pubKeyPath)
-			}
-		}
+		encoder, err := env.GetEncoder(serializerType)
 		if err != nil {
-			log.Fatalf("couldn't read key: %v", err)
-			return
+			fatalf("couldn't load formatter: %v", err)
 		}
 
-		c, err := cnf.New(yamlPath, &cipher)
-		environment, err := c.DecryptEnvironment()
-		if err != nil {
-			log.Fatalf("couldn't decrypt environment: %v", err)
+		// GitHub Actions reads variables from the file named by $GITHUB_ENV
+		// while the masking commands have to go to stdout.
+		var githubEnvPath string
+		var githubEnv bytes.Buffer
+		if serializerType == "github" {
+			githubEnvPath = os.Getenv("GITHUB_ENV")
+			if githubEnvPath == "" {
+				fatalf("GITHUB_ENV isn't set; the github formatter only works inside GitHub Actions")
+			}
+			encoder = env.GitHubEncoder{EnvFile: &githubEnv}
 		}
 
+		environment := decryptEnvironmentMatching(filter)
+
+		vars := make([]env.Variable, 0, len(environment))
 		for _, envVar := range environment {
-			fmt.Println(serializer.ToString(envVar.Name, envVar.Value))
+			if envVar.File {
+				fmt.Fprintf(os.Stderr, "skipping %s: files are only available under bens exec\n", envVar.Name)
+				continue
+			}
+			vars = append(vars, env.Variable{Name: envVar.Name, Value: envVar.Value})
+		}
+		// Format into a buffer so a value the formatter rejects doesn't
+		// leave a partial environment on stdout.
+		var out bytes.Buffer
+		if err = encoder.Encode(&out, vars); err != nil {
+			fatalf("couldn't format environment: %v", err)
+		}
+		os.Stdout.Write(out.Bytes())
+
+		if githubEnvPath != "" {
+			if err = appendToFile(githubEnvPath, githubEnv.Bytes()); err != nil {
+				fatalf("couldn't write to GITHUB_ENV: %v", err)
+			}
 		}
 	},
 }
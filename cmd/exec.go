@@ -0,0 +1,173 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+	"github.com/highfidelity/bens/mask"
+)
+
+var shouldMask bool
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().BoolVarP(
+		&shouldAskPass, "ask-pass", "", false, "ask for pass")
+	execCmd.Flags().BoolVarP(
+		&shouldMask, "mask", "", false,
+		"replace secret values in the command's stdout and stderr with ***NAME***")
+	addFilterFlags(execCmd.Flags())
+}
+
+// runCommand runs args with the environment added to bens' own and returns
+// the command's exit code.
+func runCommand(args []string, environment []string, secrets map[string]string) (int, error) {
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = append(os.Environ(), environment...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+
+	var stdout, stderr *mask.Writer
+	if secrets != nil {
+		stdout = mask.NewWriter(os.Stdout, secrets)
+		stderr = mask.NewWriter(os.Stderr, secrets)
+		child.Stdout = stdout
+		child.Stderr = stderr
+	}
+
+	if err := child.Start(); err != nil {
+		return 0, err
+	}
+
+	// Pass signals on to the command and let it decide when to exit.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+
+	err := child.Wait()
+	if stdout != nil {
+		stdout.Flush()
+		stderr.Flush()
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				if status.Signaled() {
+					return 128 + int(status.Signal()), nil
+				}
+				return status.ExitStatus(), nil
+			}
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// writeFiles writes the content of every file variable to a new directory
+// that only the user can read and returns the directory and the variables
+// set to the files' paths. The directory should be removed once the files
+// aren't needed.
+func writeFiles(environment []cnf.EnvVar) (string, []cnf.EnvVar, error) {
+	dir, err := ioutil.TempDir(secretFileRoot(), "bens")
+	if err != nil {
+		return "", nil, err
+	}
+	if err = os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	paths := make([]cnf.EnvVar, 0, len(environment))
+	for _, envVar := range environment {
+		if !envVar.File {
+			paths = append(paths, envVar)
+			continue
+		}
+		path := filepath.Join(dir, envVar.Name)
+		if err = ioutil.WriteFile(path, []byte(envVar.Value), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", nil, err
+		}
+		paths = append(paths, cnf.EnvVar{Name: envVar.Name, Value: path, Plain: true})
+	}
+	return dir, paths, nil
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] [--] COMMAND [ARGS...]",
+	Short: "Run a command with the decrypted environment",
+	Long: `Run a command with the decrypted environment.
+
+Files added with add --file are written to a temporary directory that only
+the user can read, on tmpfs where available, and their variables are set to
+the files' paths. The directory is removed when the command exits.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithEnvironment(args)
+	},
+}
+
+// execWithEnvironment runs args with the decrypted environment and exits
+// with its exit code.
+func execWithEnvironment(args []string) {
+	environment := decryptEnvironmentMatching(filter)
+
+	var files []cnf.EnvVar
+	for _, envVar := range environment {
+		if envVar.File {
+			files = append(files, envVar)
+		}
+	}
+	var dir string
+	if files != nil {
+		var err error
+		if dir, environment, err = writeFiles(environment); err != nil {
+			fatalf("couldn't write files: %v", err)
+		}
+	}
+
+	vars := make([]string, 0, len(environment))
+	var secrets map[string]string
+	if shouldMask {
+		secrets = make(map[string]string)
+	}
+	for _, envVar := range environment {
+		vars = append(vars, envVar.Name+"="+envVar.Value)
+		if secrets != nil && !envVar.Plain {
+			secrets[envVar.Name] = envVar.Value
+		}
+	}
+	for _, envVar := range files {
+		if secrets != nil && utf8.ValidString(envVar.Value) {
+			secrets[envVar.Name] = envVar.Value
+		}
+	}
+
+	code, err := runCommand(args, vars, secrets)
+	if dir != "" {
+		os.RemoveAll(dir)
+	}
+	if err != nil {
+		fatalf("couldn't run %s: %v", args[0], err)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,12 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+// secretFileRoot returns where files are written under exec: the default
+// temporary directory, since there's no tmpfs that is reliably available.
+func secretFileRoot() string {
+	return ""
+}
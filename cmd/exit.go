@@ -0,0 +1,64 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/highfidelity/bens/cnf"
+	"github.com/highfidelity/bens/key"
+)
+
+// Exit codes, documented in the README. Commands that report findings, such
+// as scan and stale, exit with exitFindings when they find something, so
+// that it can be told apart from failing to look, and exec exits with the
+// command's exit code.
+const (
+	exitError              = 1
+	exitUsage              = 2
+	exitNotFound           = 3
+	exitWrongPass          = 4
+	exitNoPrivateKey       = 5
+	exitTampered           = 6
+	exitUnsupportedVersion = 7
+	exitWrongKey           = 8
+	exitFindings           = 9
+)
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, key.ErrWrongPass):
+		return exitWrongPass
+	case errors.Is(err, key.ErrNoPrivateKey), errors.Is(err, cnf.ErrNoKey):
+		return exitNoPrivateKey
+	case errors.Is(err, key.ErrTampered):
+		return exitTampered
+	case errors.Is(err, cnf.ErrWrongKey):
+		return exitWrongKey
+	case errors.Is(err, cnf.ErrUnsupportedVersion):
+		return exitUnsupportedVersion
+	case errors.Is(err, key.ErrNotFound), errors.Is(err, cnf.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	}
+	return exitError
+}
+
+// fatalf logs like log.Fatalf and exits with the exit code of the first
+// error among args.
+func fatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	code := exitError
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			code = exitCode(err)
+			break
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,30 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/highfidelity/bens/cnf"
+)
+
+var filter cnf.Filter
+
+// addFilterFlags adds the flags that select and rename variables.
+func addFilterFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVarP(
+		&filter.Only, "only", "", nil,
+		"only variables matching one of these comma separated names or globs, such as APP_*")
+	flags.StringSliceVarP(
+		&filter.Exclude, "exclude", "", nil,
+		"leave out variables matching one of these comma separated names or globs")
+	flags.StringVarP(
+		&filter.Prefix, "prefix", "", "", "only variables whose names start with PREFIX")
+	flags.StringVarP(
+		&filter.StripPrefix, "strip-prefix", "", "", "remove PREFIX from the start of names")
+	flags.StringVarP(
+		&filter.AddPrefix, "add-prefix", "", "", "add PREFIX to the start of names")
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+)
+
+func init() {
+	rootCmd.AddCommand(gitDiffCmd)
+	rootCmd.AddCommand(gitMergeCmd)
+	rootCmd.AddCommand(gitCmd)
+	gitCmd.AddCommand(gitSetupCmd)
+}
+
+var gitDiffCmd = &cobra.Command{
+	Use:   "git-diff FILE",
+	Short: "Print a bens.yml as text for git diff",
+	Long: `Print a bens.yml as text for git diff.
+
+Used as a textconv filter. Values are decrypted when the private key and pass
+are available. Otherwise a digest of each stored value is shown so changed
+values are still visible.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var environment []cnf.EnvVar
+		if cipher, err := loadKey(); err == nil {
+			if c, err := cnf.New(args[0], &cipher); err == nil {
+				environment, _ = c.DecryptEnvironment()
+			}
+		}
+		decrypted := environment != nil
+		if !decrypted {
+			c, err := cnf.New(args[0], nil)
+			if err != nil {
+				fatalf("couldn't load yaml %s: %v", args[0], err)
+			}
+			environment = c.Digests()
+		}
+		for _, envVar := range environment {
+			if envVar.Unreadable {
+				fmt.Printf("%s = (not readable with your key)\n", envVar.Name)
+				continue
+			}
+			if envVar.File && decrypted {
+				sum := sha256.Sum256([]byte(envVar.Value))
+				fmt.Printf("%s = (file, %d bytes, sha256:%s)\n", envVar.Name, len(envVar.Value), hex.EncodeToString(sum[:6]))
+				continue
+			}
+			fmt.Printf("%s = %s\n", envVar.Name, envVar.Value)
+		}
+	},
+}
+
+var gitMergeCmd = &cobra.Command{
+	Use:   "git-merge BASE OURS THEIRS",
+	Short: "Merge bens.yml files for git",
+	Long: `Merge bens.yml files for git.
+
+Used as a merge driver. Variables, recipients and groups are matched by name
+so ones added on both branches merge cleanly. The result is written to OURS.
+When one was changed differently on both branches our version is kept, the
+conflict is reported and the merge fails.`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		var files [3]cnf.Cnf
+		for i, path := range args {
+			c, err := cnf.New(path, nil)
+			if err != nil {
+				fatalf("couldn't load yaml %s: %v", path, err)
+			}
+			files[i] = c
+		}
+
+		merged, conflicts := cnf.Merge(files[0], files[1], files[2])
+		if err := merged.Save(args[1]); err != nil {
+			fatalf("couldn't save merge: %v", err)
+		}
+		for _, name := range conflicts {
+			fmt.Fprintf(os.Stderr, "conflict: %s was changed on both branches; kept ours\n", name)
+		}
+		if len(conflicts) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+var gitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Git integration",
+}
+
+// addLine appends line to the file at path unless it already has it.
+func addLine(path, line string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == line {
+			return nil
+		}
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		line = "\n" + line
+	}
+	return appendToFile(path, []byte(line+"\n"))
+}
+
+// gitTopLevel returns the top directory of the working tree.
+func gitTopLevel() (string, error) {
+	git := exec.Command("git", "rev-parse", "--show-toplevel")
+	git.Stderr = os.Stderr
+	out, err := git.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gitConfig(name, value string) error {
+	git := exec.Command("git", "config", name, value)
+	git.Stderr = os.Stderr
+	return git.Run()
+}
+
+var gitSetupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Configure git to diff and merge bens.yml with bens",
+	Long: `Configure git to diff and merge bens.yml with bens.
+
+Adds the diff and merge attributes for the configuration file to
+.gitattributes at the top of the working tree, ignores its lock file in
+.gitignore there and configures the bens diff and merge drivers in the
+repository's git config.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		top, err := gitTopLevel()
+		if err != nil {
+			fatalf("couldn't find the top of the working tree: %v", err)
+		}
+		attribute := fmt.Sprintf("%s diff=bens merge=bens", filepath.Base(yamlPath))
+		if err = addLine(filepath.Join(top, ".gitattributes"), attribute); err != nil {
+			fatalf("couldn't update .gitattributes: %v", err)
+		}
+		// Commands that change the configuration file lock it with a file
+		// next to it that is left behind.
+		if err = addLine(filepath.Join(top, ".gitignore"), filepath.Base(yamlPath)+".lock"); err != nil {
+			fatalf("couldn't update .gitignore: %v", err)
+		}
+
+		config := [][2]string{
+			{"diff.bens.textconv", "bens git-diff"},
+			{"merge.bens.name", "bens environment merge"},
+			{"merge.bens.driver", "bens git-merge %O %A %B"},
+		}
+		for _, c := range config {
+			if err := gitConfig(c[0], c[1]); err != nil {
+				fatalf("couldn't set git config %s: %v", c[0], err)
+			}
+		}
+	},
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/key"
+)
+
+var shouldListValues bool
+var shareCount, shareThreshold int
+var shareDir, combinedKeyPath string
+var shouldForce bool
+
+func init() {
+	rootCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(fingerprintCmd)
+	keyCmd.AddCommand(splitCmd)
+	keyCmd.AddCommand(combineCmd)
+	fingerprintCmd.Flags().BoolVarP(
+		&shouldListValues, "values", "", false,
+		"also list the key each encrypted value was encrypted for")
+	splitCmd.Flags().BoolVarP(
+		&shouldAskPass, "ask-pass", "", false, "ask for pass")
+	splitCmd.Flags().IntVarP(&shareCount, "shares", "n", 5, "number of shares")
+	splitCmd.Flags().IntVarP(&shareThreshold, "threshold", "k", 3, "number of shares needed to recover the key")
+	splitCmd.Flags().StringVarP(&shareDir, "output-dir", "o", ".", "write share-N.txt files to DIR")
+	combineCmd.Flags().StringVarP(&combinedKeyPath, "output", "o", "pri.key", "write the private key to FILE")
+	for _, c := range []*cobra.Command{splitCmd, combineCmd} {
+		c.Flags().BoolVarP(&shouldForce, "force", "f", false, "replace files that already exist")
+	}
+}
+
+// checkNotExist fails unless --force is given when any of paths exists, so
+// a key or share that may be the only copy isn't replaced by accident.
+func checkNotExist(paths ...string) error {
+	if shouldForce {
+		return nil
+	}
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s already exists; use --force to replace it", path)
+		}
+	}
+	return nil
+}
+
+// readNewPass returns $BENS_PASS or asks for a new pass twice.
+func readNewPass() ([]byte, error) {
+	if pass := os.Getenv("BENS_PASS"); pass != "" {
+		return []byte(pass), nil
+	}
+	pass, err := readPassFromTerm("new password")
+	if err != nil {
+		return nil, err
+	}
+	again, err := readPassFromTerm("new password again")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, again) {
+		return nil, fmt.Errorf("passwords don't match")
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("password is empty")
+	}
+	return pass, nil
+}
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Inspect and split keys",
+}
+
+var fingerprintCmd = &cobra.Command{
+	Use:   "fingerprint [PUBLIC_KEY_FILE...]",
+	Short: "Print the fingerprint of public keys",
+	Long: `Print the fingerprint of public keys.
+
+The fingerprint is the SHA-256 of the public key, the way ssh-keygen -l shows
+it. Encrypted values record the fingerprint of the key they were encrypted
+for. Without arguments the fingerprint of --public-key-file is printed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{pubKeyPath}
+		}
+		for _, path := range args {
+			k, err := key.NewWithPass(nil, "", path)
+			if err != nil {
+				fatalf("couldn't read public key: %v", err)
+			}
+			fmt.Printf("%s\t%s\n", k.Fingerprint(), path)
+		}
+
+		if !shouldListValues {
+			return
+		}
+		for _, layer := range loadLayers() {
+			keys := layer.Cnf.EncryptedFor()
+			for _, name := range layer.Cnf.Names() {
+				fingerprint, ok := keys[name]
+				if !ok {
+					continue
+				}
+				if fingerprint == "" {
+					fingerprint = "unknown"
+				}
+				fmt.Printf("%s\t%s\t%s\n", name, fingerprint, layer.Path)
+			}
+		}
+	},
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split the private key into shares",
+	Long: `Split the private key into shares.
+
+Any --threshold of the --shares shares recover the key with key combine or
+unlock; fewer reveal nothing about it. Each share is written to its own file,
+readable only by the user, to hand to one holder. Once the shares are
+distributed, pri.key and the pass file can be removed. Existing share files
+are only replaced with --force.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Shares are numbered from 1.
+		paths := make([]string, shareCount)
+		for i := range paths {
+			paths[i] = filepath.Join(shareDir, fmt.Sprintf("share-%d.txt", i+1))
+		}
+		if err := checkNotExist(paths...); err != nil {
+			fatalf("%v", err)
+		}
+		k, err := loadKey()
+		if err != nil {
+			fatalf("couldn't read key: %v", err)
+		}
+		shares, err := k.Split(shareCount, shareThreshold)
+		if err != nil {
+			fatalf("couldn't split key: %v", err)
+		}
+		for _, share := range shares {
+			path := filepath.Join(shareDir, fmt.Sprintf("share-%d.txt", share.Index))
+			if err = writePrivateFile(path, []byte(share.String()+"\n"), shouldForce); err != nil {
+				fatalf("couldn't write %s: %v", path, err)
+			}
+			fmt.Println(path)
+		}
+	},
+}
+
+var combineCmd = &cobra.Command{
+	Use:   "combine [SHARE_FILE...]",
+	Short: "Recover the private key from shares",
+	Long: `Recover the private key from shares.
+
+The shares are read from the files given and the rest are asked for. The key
+is written to --output, encrypted with a new pass taken from $BENS_PASS or
+asked for. An existing file is only replaced with --force.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkNotExist(combinedKeyPath); err != nil {
+			fatalf("%v", err)
+		}
+		shares, err := readShares(args)
+		if err != nil {
+			fatalf("couldn't read shares: %v", err)
+		}
+		k, err := key.FromShares(shares)
+		if err != nil {
+			fatalf("couldn't recover key: %v", err)
+		}
+		pass, err := readNewPass()
+		if err != nil {
+			fatalf("couldn't read pass: %v", err)
+		}
+		pri, err := k.MarshalPrivateKey(pass)
+		zero(pass)
+		if err != nil {
+			fatalf("couldn't encrypt key: %v", err)
+		}
+		if err = writePrivateFile(combinedKeyPath, pri, shouldForce); err != nil {
+			fatalf("couldn't write %s: %v", combinedKeyPath, err)
+		}
+	},
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+)
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the configuration file to the current format",
+	Long: `Upgrade the configuration file to the current format.
+
+The file is written in the oldest version that can hold its content, like
+every other command that saves it, so it stays readable by older versions of
+bens where possible. The original file is kept next to it as FILE.vN.bak,
+where N is the version it was written in. Nothing needs to be decrypted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		lock, err := cnf.LockFile(yamlPath)
+		if err != nil {
+			fatalf("couldn't lock %s: %v", yamlPath, err)
+		}
+		defer lock.Unlock()
+
+		c, backupPath, err := cnf.Migrate(yamlPath)
+		if err != nil {
+			fatalf("couldn't migrate %s: %v", yamlPath, err)
+		}
+		if backupPath == "" {
+			fmt.Printf("%s is already version %d\n", yamlPath, c.FileVersion())
+			return
+		}
+		fmt.Printf("upgraded %s from version %d to %d; the original is in %s\n",
+			yamlPath, c.FileVersion(), c.SaveVersion(), backupPath)
+	},
+}
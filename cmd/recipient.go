@@ -0,0 +1,62 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+)
+
+var recipientGroups []string
+
+func init() {
+	rootCmd.AddCommand(recipientCmd)
+	recipientCmd.AddCommand(recipientAddCmd)
+	recipientAddCmd.Flags().StringSliceVarP(&recipientGroups, "group", "", nil,
+		"add the recipient to these comma separated groups, creating them if needed")
+}
+
+var recipientCmd = &cobra.Command{
+	Use:   "recipient",
+	Short: "Manage who can decrypt variables restricted to groups",
+}
+
+var recipientAddCmd = &cobra.Command{
+	Use:   "add NAME PUBLIC_KEY_FILE",
+	Short: "Add a recipient, or replace their public key, and add them to groups",
+	Long: `Add a recipient, or replace their public key, and add them to groups.
+
+Variables added with add --group are encrypted for every recipient in the
+groups. Values that are already stored are only encrypted for a new member
+once they are set again.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		publicKey, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			fatalf("couldn't read public key: %v", err)
+		}
+
+		lock, err := cnf.LockFile(yamlPath)
+		if err != nil {
+			fatalf("couldn't lock %s: %v", yamlPath, err)
+		}
+		defer lock.Unlock()
+
+		c, err := cnf.New(yamlPath, nil)
+		if err != nil {
+			fatalf("couldn't load yaml %s: %v", yamlPath, err)
+		}
+		if err = c.AddRecipient(args[0], publicKey, recipientGroups); err != nil {
+			fatalf("couldn't add recipient: %v", err)
+		}
+		if err = c.Save(yamlPath); err != nil {
+			fatalf("couldn't save yaml to %s: %v", yamlPath, err)
+		}
+	},
+}
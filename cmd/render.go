@@ -0,0 +1,117 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+	"github.com/highfidelity/bens/render"
+)
+
+var renderOutput string
+var shouldCheck bool
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.Flags().BoolVarP(
+		&shouldAskPass, "ask-pass", "", false, "ask for pass")
+	renderCmd.Flags().StringVarP(
+		&renderOutput, "output", "o", "", "write to FILE, readable only by the user, instead of stdout")
+	renderCmd.Flags().BoolVarP(
+		&shouldCheck, "check", "", false,
+		"list references to variables that aren't defined instead; doesn't need the private key")
+}
+
+// writePrivateFile writes data to path, which only the user can read. An
+// existing file is only replaced when replace is true.
+func writePrivateFile(path string, data []byte, replace bool) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if replace {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return err
+	}
+	if err = f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render TEMPLATE",
+	Short: "Render a Go text/template with the decrypted environment",
+	Long: `Render a Go text/template with the decrypted environment.
+
+{{.NAME}} is the value of NAME, and referring to an undefined variable that
+way is an error. The template can also use these functions:
+
+  env "NAME"            the value of NAME, or "" if it isn't defined
+  required "NAME"       the value of NAME, which must be defined and not empty
+  default "x" VALUE     x if VALUE is empty, otherwise VALUE
+  base64 VALUE          VALUE encoded as standard base64
+  json VALUE            VALUE as a quoted JSON string
+
+For example: {{env "PORT" | default "8080"}}`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		text, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fatalf("couldn't read template: %v", err)
+		}
+		tmpl, err := render.Parse(args[0], string(text))
+		if err != nil {
+			fatalf("couldn't parse template: %v", err)
+		}
+
+		if shouldCheck {
+			var names []string
+			for _, source := range cnf.Sources(loadLayers()) {
+				names = append(names, source.Name)
+			}
+			missing := tmpl.Missing(names)
+			for _, ref := range missing {
+				fmt.Printf("%s: %s isn't defined\n", ref.Location, ref.Name)
+			}
+			if len(missing) > 0 {
+				os.Exit(exitFindings)
+			}
+			return
+		}
+
+		environment := decryptEnvironment()
+		values := make(map[string]string, len(environment))
+		for _, envVar := range environment {
+			values[envVar.Name] = envVar.Value
+		}
+		// Render into a buffer so a failing template doesn't leave partial
+		// output behind.
+		var out bytes.Buffer
+		if err = tmpl.Execute(&out, values); err != nil {
+			fatalf("couldn't render template: %v", err)
+		}
+
+		if renderOutput == "" {
+			os.Stdout.Write(out.Bytes())
+			return
+		}
+		if err = writePrivateFile(renderOutput, out.Bytes(), true); err != nil {
+			fatalf("couldn't write %s: %v", renderOutput, err)
+		}
+	},
+}
@@ -7,17 +7,104 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
 )
 
 var yamlPath, passPath, priKeyPath, pubKeyPath string
 
+// yamlPaths are the configuration files layered in the order given. Commands
+// that change the configuration change yamlPath, the last one.
+var yamlPaths []string
+
+// configRoot is the directory the configuration was found in by walking up
+// from the working directory, or "" if it wasn't looked for or found.
+var configRoot string
+
+// pathOrigins records where the value of each path flag came from.
+var pathOrigins = make(map[string]string)
+
+// keyFlags are the flags naming key files.
+var keyFlags = []struct {
+	name  string
+	value *string
+}{
+	{"pass-file", &passPath},
+	{"private-key-file", &priKeyPath},
+	{"public-key-file", &pubKeyPath},
+}
+
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&yamlPath, "config-file", "c", "bens.yml", "configuration file")
+	rootCmd.PersistentFlags().StringArrayVarP(&yamlPaths, "config-file", "c", []string{cnf.FileName},
+		"configuration file; repeat to layer files, later ones taking precedence")
 	rootCmd.PersistentFlags().StringVarP(&passPath, "pass-file", "p", "pass.txt", "pass file")
 	rootCmd.PersistentFlags().StringVarP(&priKeyPath, "private-key-file", "", "pri.key", "private key file")
 	rootCmd.PersistentFlags().StringVarP(&pubKeyPath, "public-key-file", "", "pub.key", "public key file")
+	rootCmd.PersistentFlags().StringVarP(&pkcs11Module, "pkcs11-module", "", "",
+		"decrypt with the private key on the PKCS#11 token this library talks to instead of the private key file")
+	rootCmd.PersistentFlags().UintVarP(&pkcs11Slot, "pkcs11-slot", "", 0, "slot ID of the PKCS#11 token, as listed by softhsm2-util --show-slots or pkcs11-tool --list-slots")
+	rootCmd.PersistentFlags().StringVarP(&pkcs11Label, "pkcs11-label", "", "",
+		"label of the private key, if the token has several")
+	cobra.OnInitialize(resolvePaths)
+}
+
+// resolvePaths sets the flags that weren't given on the command line from
+// the environment and configuration files, and finds the configuration for
+// the path flags that are still unset. Like git finds .git, bens looks for a
+// .bens directory or a bens.yml in the working directory and its parents,
+// and takes the configuration file and keys from the directory it finds.
+func resolvePaths() {
+	flags := rootCmd.PersistentFlags()
+	names := []string{"config-file"}
+	for _, f := range keyFlags {
+		names = append(names, f.name)
+	}
+	for _, name := range names {
+		if flags.Changed(name) {
+			pathOrigins[name] = "flag"
+		}
+	}
+	if err := applySettings(flags); err != nil {
+		fatalf("couldn't load settings: %v", err)
+	}
+	allGiven := true
+	for _, name := range names {
+		if !flags.Changed(name) {
+			pathOrigins[name] = "default"
+			allGiven = false
+		}
+	}
+
+	if !allGiven {
+		root, err := cnf.Find(".")
+		if err != nil {
+			fatalf("couldn't look for %s: %v", cnf.FileName, err)
+		}
+		if root != "" {
+			configRoot = root
+			if wd, err := os.Getwd(); err == nil {
+				if rel, err := filepath.Rel(wd, root); err == nil {
+					root = rel
+				}
+			}
+			origin := "found in " + configRoot
+			if !flags.Changed("config-file") {
+				yamlPaths = []string{filepath.Join(root, cnf.FileName)}
+				pathOrigins["config-file"] = origin
+			}
+			for _, f := range keyFlags {
+				if !flags.Changed(f.name) {
+					*f.value = filepath.Join(root, flags.Lookup(f.name).DefValue)
+					pathOrigins[f.name] = origin
+				}
+			}
+		}
+	}
+	yamlPath = yamlPaths[len(yamlPaths)-1]
 }
 
 var rootCmd = &cobra.Command{
@@ -28,6 +115,8 @@ var rootCmd = &cobra.Command{
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatalf("error: %v", err)
+		// Commands exit on their own errors, so these are usage errors.
+		log.Printf("error: %v", err)
+		os.Exit(exitUsage)
 	}
 }
@@ -0,0 +1,107 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/scan"
+)
+
+var gitDiffRange string
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	scanCmd.Flags().BoolVarP(
+		&shouldAskPass, "ask-pass", "", false, "ask for pass")
+	scanCmd.Flags().StringVarP(
+		&gitDiffRange, "git-diff", "", "",
+		"scan the lines added by git diff REVISIONS instead of files, e.g. origin/master...HEAD")
+	scanCmd.Flags().Lookup("git-diff").NoOptDefVal = "HEAD"
+}
+
+func scanGitDiff(m *scan.Matcher, revisions string) ([]scan.Finding, error) {
+	git := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "-U0", revisions)
+	git.Stderr = os.Stderr
+	out, err := git.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = git.Start(); err != nil {
+		return nil, err
+	}
+	findings, err := m.Diff(out)
+	if err != nil {
+		git.Wait()
+		return nil, err
+	}
+	if err = git.Wait(); err != nil {
+		return nil, fmt.Errorf("git diff failed: %v", err)
+	}
+	return findings, nil
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [PATH...]",
+	Short: "Look for plaintext copies of the environment's values",
+	Long: `Look for plaintext copies of the environment's values.
+
+Every file below each PATH (the working directory by default) is searched
+for the values and their base64 and URL encoded forms. With --git-diff only
+the lines added by the diff are searched. Findings name the file, line and
+variable but never the value. scan exits with status 9 if anything is found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		environment := decryptEnvironment()
+		secrets := make(map[string]string, len(environment))
+		for _, envVar := range environment {
+			// Binary files can't leak as text.
+			if !envVar.Plain && (!envVar.File || utf8.ValidString(envVar.Value)) {
+				secrets[envVar.Name] = envVar.Value
+			}
+		}
+		m, err := scan.NewMatcher(secrets)
+		if err != nil {
+			fatalf("couldn't prepare scan: %v", err)
+		}
+		secrets = nil
+		environment = nil
+
+		for _, name := range m.Skipped {
+			fmt.Fprintf(os.Stderr, "skipping %s: shorter than %d characters\n", name, scan.MinLength)
+		}
+
+		var findings []scan.Finding
+		if gitDiffRange != "" {
+			findings, err = scanGitDiff(m, gitDiffRange)
+			if err != nil {
+				fatalf("couldn't scan git diff: %v", err)
+			}
+		} else {
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			for _, path := range args {
+				pathFindings, err := m.Tree(path)
+				if err != nil {
+					fatalf("couldn't scan %s: %v", path, err)
+				}
+				findings = append(findings, pathFindings...)
+			}
+		}
+
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		if len(findings) > 0 {
+			os.Exit(exitFindings)
+		}
+	},
+}
@@ -0,0 +1,39 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/cnf"
+)
+
+func init() {
+	rootCmd.AddCommand(sourcesCmd)
+}
+
+var sourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "List the file each variable comes from",
+	Long: `List the file each variable comes from.
+
+The configuration files, given with --config-file and through includes, are
+layered so later files override earlier ones. Overridden definitions are
+listed after the file that wins. Nothing is decrypted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, source := range cnf.Sources(loadLayers()) {
+			if len(source.Overrides) == 0 {
+				fmt.Printf("%s\t%s\n", source.Name, source.Path)
+				continue
+			}
+			fmt.Printf("%s\t%s (overrides %s)\n", source.Name, source.Path, strings.Join(source.Overrides, ", "))
+		}
+	},
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var olderThan string
+
+func init() {
+	rootCmd.AddCommand(staleCmd)
+	staleCmd.Flags().StringVarP(
+		&olderThan, "older-than", "", "",
+		"also list variables not rotated for longer than this age, such as 90d, 12w or 36h")
+}
+
+// parseAge parses a Go duration, with d (days) and w (weeks) units added.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %s", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %s", s)
+	}
+	return d, nil
+}
+
+// parseTimeOrAge parses a date, an RFC 3339 time or an age from now.
+func parseTimeOrAge(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s: use 2006-01-02, RFC 3339 or an age such as 90d", s)
+	}
+	return time.Now().Add(d), nil
+}
+
+var staleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "List variables that expired or are overdue for rotation",
+	Long: `List variables that expired or are overdue for rotation.
+
+Without --older-than only expired variables are listed. With it, variables
+that haven't been rotated, or created, within that age are listed too, as are
+variables with no record of when they were created. Every layer is checked
+and each variable is listed with the file that defines it. stale exits with
+status 9 if it lists anything. Nothing needs to be decrypted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var maxAge time.Duration
+		if olderThan != "" {
+			var err error
+			if maxAge, err = parseAge(olderThan); err != nil {
+				fatalf("%v", err)
+			}
+		}
+
+		found := false
+		for _, layer := range loadLayers() {
+			for _, s := range layer.Cnf.Stale(maxAge) {
+				line := fmt.Sprintf("%s: %s", s.Name, s.Reason)
+				if s.Metadata.Owner != "" {
+					line += fmt.Sprintf(" (owner %s)", s.Metadata.Owner)
+				}
+				fmt.Printf("%s\t%s\n", line, layer.Path)
+				found = true
+			}
+		}
+		if found {
+			os.Exit(exitFindings)
+		}
+	},
+}
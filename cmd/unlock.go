@@ -0,0 +1,99 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+
+	"github.com/highfidelity/bens/key"
+)
+
+// unlockedKey is the key recovered from shares by unlock. It replaces the
+// key files of every configuration file.
+var unlockedKey *key.Key
+
+var shareFiles []string
+
+func init() {
+	rootCmd.AddCommand(unlockCmd)
+	unlockCmd.Flags().SetInterspersed(false)
+	unlockCmd.Flags().StringArrayVarP(&shareFiles, "share", "", nil,
+		"read a share from FILE; can be repeated. Missing shares are asked for")
+	unlockCmd.Flags().BoolVarP(
+		&shouldMask, "mask", "", false,
+		"replace secret values in the command's stdout and stderr with ***NAME***")
+	addFilterFlags(unlockCmd.Flags())
+}
+
+// readShares reads the shares in paths and asks for more on the terminal
+// until there are as many as the threshold.
+func readShares(paths []string) ([]key.Share, error) {
+	var shares []key.Share
+	for _, path := range paths {
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		share, err := key.ParseShare(string(text))
+		zero(text)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse %s: %v", path, err)
+		}
+		shares = append(shares, share)
+	}
+	for len(shares) == 0 || len(shares) < shares[0].Threshold {
+		prompt := "share"
+		if len(shares) > 0 {
+			prompt = fmt.Sprintf("share %d of %d", len(shares)+1, shares[0].Threshold)
+		}
+		text, err := readPassFromTerm(prompt)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read share from terminal: %v", err)
+		}
+		share, err := key.ParseShare(string(text))
+		zero(text)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+func zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock [flags] [--] COMMAND [ARGS...]",
+	Short: "Recover the private key from shares and run a command with the environment",
+	Long: `Recover the private key from shares and run a command with the environment.
+
+The private key is split into shares with key split so that no single person
+can decrypt the environment. unlock reads the shares given with --share and
+asks for the rest, one per holder, until it has as many as the threshold. The
+key is recovered in locked memory, used to decrypt the environment like exec
+and forgotten when the command exits. It never touches the disk and no pass is
+needed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		shares, err := readShares(shareFiles)
+		if err != nil {
+			fatalf("couldn't read shares: %v", err)
+		}
+		k, err := key.FromShares(shares)
+		if err != nil {
+			fatalf("couldn't recover key: %v", err)
+		}
+		unlockedKey = &k
+		execWithEnvironment(args)
+	},
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(whereCmd)
+}
+
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+var whereCmd = &cobra.Command{
+	Use:   "where",
+	Short: "Print the configuration file and keys bens uses",
+	Long: `Print the configuration file and keys bens uses.
+
+Each path is printed with where it came from: a flag, a BENS_* environment
+variable, a configuration file, the directory bens found by walking up from
+the working directory, or the default.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if configRoot != "" {
+			fmt.Printf("root\t%s\n", configRoot)
+		}
+		abs := make([]string, 0, len(yamlPaths))
+		for _, path := range yamlPaths {
+			abs = append(abs, absPath(path))
+		}
+		fmt.Printf("config-file\t%s\t(%s)\n", strings.Join(abs, ", "), pathOrigins["config-file"])
+		for _, f := range keyFlags {
+			fmt.Printf("%s\t%s\t(%s)\n", f.name, absPath(*f.value), pathOrigins[f.name])
+		}
+	},
+}
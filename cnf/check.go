@@ -0,0 +1,100 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Problem is something wrong with a variable. Warnings don't stop the
+// environment from being used. Source is the file the variable is defined
+// in, when known.
+type Problem struct {
+	Name    string
+	Source  string
+	Err     error
+	Warning bool
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %v", p.Name, p.Err)
+}
+
+// Check decrypts every value, without returning it, and expands templates.
+// It reports the values that fail, names that aren't valid environment
+// variable names and, as warnings, names defined more than once.
+func (c *Cnf) Check() []Problem {
+	problems, values := c.checkValues()
+	if _, err := c.resolve(values); err != nil {
+		problems = append(problems, Problem{Err: err})
+	}
+	return problems
+}
+
+// CheckLayers checks every layer like Check, but expands templates across
+// layers the way DecryptLayers does, so templates can refer to variables of
+// any layer. Problems are marked with the path of the layer they are in.
+// Encrypted values of layers without a cipher aren't checked.
+func CheckLayers(layers []Layer) []Problem {
+	var problems []Problem
+	var combined Cnf
+	var values []rawValue
+	for _, layer := range layers {
+		layerProblems, layerValues := layer.Cnf.checkValues()
+		for _, p := range layerProblems {
+			if errors.Is(p.Err, ErrNoKey) {
+				continue
+			}
+			p.Source = layer.Path
+			problems = append(problems, p)
+		}
+		combined.root.Environment = append(combined.root.Environment, layer.Cnf.root.Environment...)
+		values = append(values, layerValues...)
+	}
+	if _, err := combined.resolve(values); err != nil {
+		problems = append(problems, Problem{Err: err})
+	}
+	return problems
+}
+
+// checkValues reports the problems of the variables of c, except those of
+// their templates, and returns their values for resolve. Values that can't
+// be decrypted are returned as unreadable, so templates that refer to them
+// aren't reported as well.
+func (c *Cnf) checkValues() ([]Problem, []rawValue) {
+	var problems []Problem
+	seen := make(map[string]int)
+	for _, envVar := range c.root.Environment {
+		seen[envVar.Name]++
+		if seen[envVar.Name] == 2 {
+			problems = append(problems, Problem{
+				Name:    envVar.Name,
+				Err:     fmt.Errorf("defined more than once; the last definition wins"),
+				Warning: true,
+			})
+		}
+		if !isValidName(envVar.Name) {
+			problems = append(problems, Problem{Name: envVar.Name, Err: fmt.Errorf("invalid name")})
+		}
+	}
+
+	values := make([]rawValue, 0, len(c.root.Environment))
+	for _, envVar := range c.root.Environment {
+		val, err := c.decrypt(envVar)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrNoAccess):
+			problems = append(problems, Problem{Name: envVar.Name, Err: fmt.Errorf("can't decrypt: %w", err), Warning: true})
+			val = rawValue{denied: true}
+		default:
+			problems = append(problems, Problem{Name: envVar.Name, Err: fmt.Errorf("couldn't decrypt: %w", err)})
+			val = rawValue{denied: true}
+		}
+		values = append(values, val)
+	}
+	return problems, values
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type FailingCipher struct {
+	IdentityCipher
+}
+
+func (FailingCipher) Decrypt(cipherText string) (string, error) {
+	if cipherText == "bad" {
+		return "", fmt.Errorf("tampered")
+	}
+	return cipherText, nil
+}
+
+func TestCheck(t *testing.T) {
+	c := Cnf{cipher: FailingCipher{}}
+	c.Add("GOOD", "good")
+	c.Add("BROKEN", "bad")
+	c.Add("GOOD", "again")
+	c.AddPlain("not-valid", "x")
+
+	var got []string
+	for _, p := range c.Check() {
+		got = append(got, fmt.Sprintf("%s %v", p, p.Warning))
+	}
+	expected := []string{
+		"GOOD: defined more than once; the last definition wins true",
+		"not-valid: invalid name false",
+		"BROKEN: couldn't decrypt: tampered false",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	c = Cnf{cipher: IdentityCipher{}}
+	c.AddTemplate("URL", "${MISSING}", false)
+	if problems := c.Check(); len(problems) != 1 || !strings.Contains(problems[0].Err.Error(), "MISSING isn't defined") {
+		t.Fatalf("expected an interpolation problem; got %v", problems)
+	}
+}
+
+func TestCheckLayers(t *testing.T) {
+	base := Cnf{cipher: IdentityCipher{}}
+	base.AddPlain("HOST", "example.com")
+	service := Cnf{cipher: FailingCipher{}}
+	service.AddTemplate("URL", "https://${HOST}", false)
+	service.Add("BROKEN", "bad")
+	layers := []Layer{{Path: "base.yml", Cnf: base}, {Path: "bens.yml", Cnf: service}}
+
+	problems := CheckLayers(layers)
+	if len(problems) != 1 || problems[0].Name != "BROKEN" || problems[0].Source != "bens.yml" {
+		t.Fatalf("templates should resolve across layers; got %v", problems)
+	}
+
+	layers[0].Cnf = Cnf{}
+	problems = CheckLayers(layers)
+	if len(problems) != 2 || !strings.Contains(problems[1].Err.Error(), "HOST isn't defined") {
+		t.Fatalf("expected an interpolation problem; got %v", problems)
+	}
+}
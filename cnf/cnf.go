@@ -6,79 +6,362 @@
 package cnf
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
+// yamlEnvVar is a variable in bens.yml. Its value is one of EncryptedValue,
+// Value, a plaintext value that isn't secret, Template, a plaintext value
+// that refers to other variables, or EncryptedFile, the encrypted content of
+// a file. Interpolate marks an EncryptedValue as a template too. Key is the
+// fingerprint of the key an encrypted value or file was encrypted for.
+// Variables restricted to Groups are instead encrypted for each of their
+// members in EncryptedFor.
 type yamlEnvVar struct {
 	Name           string
-	EncryptedValue string `yaml:"encryptedValue"`
+	EncryptedValue string               `yaml:"encryptedValue,omitempty"`
+	Value          *string              `yaml:"value,omitempty"`
+	Template       string               `yaml:"template,omitempty"`
+	Interpolate    bool                 `yaml:"interpolate,omitempty"`
+	EncryptedFile  string               `yaml:"encryptedFile,omitempty"`
+	Key            string               `yaml:"key,omitempty"`
+	Groups         []string             `yaml:"groups,omitempty"`
+	EncryptedFor   []yamlRecipientValue `yaml:"encryptedFor,omitempty"`
+	Description    string               `yaml:"description,omitempty"`
+	Owner          string               `yaml:"owner,omitempty"`
+	Created        *time.Time           `yaml:"created,omitempty"`
+	Rotated        *time.Time           `yaml:"rotated,omitempty"`
+	Expires        *time.Time           `yaml:"expires,omitempty"`
 }
 
 type yamlRoot struct {
 	Version     int
+	Includes    []yamlInclude   `yaml:"includes,omitempty"`
+	Recipients  []yamlRecipient `yaml:"recipients,omitempty"`
+	Groups      []yamlGroup     `yaml:"groups,omitempty"`
 	Environment []yamlEnvVar
 }
 
 type cipher interface {
 	Decrypt(string) (string, error)
 	Encrypt(string) (string, error)
+	DecryptBytes(string) ([]byte, error)
+	EncryptBytes([]byte) (string, error)
+}
+
+// fingerprinter is a cipher that can tell which key it holds. Values record
+// the fingerprint of the key they are encrypted for so that decrypting them
+// with another key can be reported as such.
+type fingerprinter interface {
+	Fingerprint() string
+}
+
+// fingerprint returns the fingerprint of the cipher's key, or "" if it
+// doesn't have one.
+func (c *Cnf) fingerprint() string {
+	if f, ok := c.cipher.(fingerprinter); ok {
+		return f.Fingerprint()
+	}
+	return ""
+}
+
+// lazyCipher is a cipher that loads its key on first use and can tell why it
+// couldn't.
+type lazyCipher interface {
+	Load() error
 }
 
 type Cnf struct {
 	root   yamlRoot
 	cipher cipher
+	// fileVersion is the version the file was written in, before any
+	// migrations ran.
+	fileVersion int
 }
 
 type EnvVar struct {
 	Name  string
 	Value string
+	// Plain is set for values that were stored as plaintext because they
+	// aren't secret.
+	Plain bool
+	// File is set for file contents. Value holds the content, which needn't
+	// be text, and is usually written to a file rather than used directly.
+	File bool
+	// Source is the path of the file the value comes from when layers are
+	// decrypted together.
+	Source string
+	// Unreadable is set for variables restricted to groups that the key
+	// decrypting them isn't a member of, and for templates that refer to
+	// them. Value is empty.
+	Unreadable bool
 }
 
 func (c *Cnf) Add(name, value string) error {
 	cipherText, err := c.cipher.Encrypt(value)
 	if err != nil {
-		return fmt.Errorf("couldn't encrypt %s: %v", value, err)
+		return fmt.Errorf("couldn't encrypt %s: %v", name, err)
 	}
-	v := yamlEnvVar{Name: name, EncryptedValue: cipherText}
+	v := yamlEnvVar{Name: name, EncryptedValue: cipherText, Key: c.fingerprint(), Created: timestamp()}
 	c.root.Environment = append(c.root.Environment, v)
 	return nil
 }
 
-func (c *Cnf) Save(yamlPath string) error {
+// WriteTo writes the configuration as YAML to w. The version is set to the
+// oldest one that can hold the content.
+func (c *Cnf) WriteTo(w io.Writer) (int64, error) {
+	c.root.Version = c.root.minimumVersion()
 	out, err := yaml.Marshal(&c.root)
 	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(out)
+	return int64(n), err
+}
+
+// Save writes the configuration to yamlPath, replacing the file atomically.
+func (c *Cnf) Save(yamlPath string) error {
+	var out bytes.Buffer
+	if _, err := c.WriteTo(&out); err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(yamlPath, out, 0644); err != nil {
+	if err := writeFileAtomic(yamlPath, out.Bytes()); err != nil {
 		return fmt.Errorf("couldn't save to %s: %v", yamlPath, err)
 	}
 	return nil
 }
 
+// Names returns the name of every variable in the environment, in order and
+// without duplicates. It doesn't need to decrypt anything.
+func (c *Cnf) Names() []string {
+	names := make([]string, 0, len(c.root.Environment))
+	seen := make(map[string]bool)
+	for _, envVar := range c.root.Environment {
+		if !seen[envVar.Name] {
+			seen[envVar.Name] = true
+			names = append(names, envVar.Name)
+		}
+	}
+	return names
+}
+
+// EncryptedFor maps the name of every encrypted variable to the fingerprint
+// of the key it was encrypted for, or "" for values written before keys
+// were recorded. It doesn't need to decrypt anything.
+func (c *Cnf) EncryptedFor() map[string]string {
+	keys := make(map[string]string)
+	for _, envVar := range c.root.Environment {
+		if envVar.EncryptedValue != "" || envVar.EncryptedFile != "" {
+			keys[envVar.Name] = envVar.Key
+		}
+		if len(envVar.EncryptedFor) > 0 {
+			var fingerprints []string
+			for _, v := range envVar.EncryptedFor {
+				fingerprints = append(fingerprints, v.Key)
+			}
+			keys[envVar.Name] = strings.Join(fingerprints, ",")
+		}
+	}
+	return keys
+}
+
+// CheckKey reports, wrapping ErrWrongKey, a value that was encrypted for
+// another key than the cipher's, so that values aren't added for a public
+// key that doesn't belong to the private key the other values need. Values
+// named name, which are about to be replaced, values encrypted for groups and
+// values that don't record their key are ignored.
+func (c *Cnf) CheckKey(name string) error {
+	have := c.fingerprint()
+	if have == "" {
+		return nil
+	}
+	for _, envVar := range c.root.Environment {
+		if envVar.Name != name && envVar.Key != "" && envVar.Key != have {
+			return fmt.Errorf("%w: %s is encrypted for key %s, the public key is %s", ErrWrongKey, envVar.Name, envVar.Key, have)
+		}
+	}
+	return nil
+}
+
+// AddTemplate adds a variable whose value refers to other variables as
+// ${NAME}. The template is stored as plaintext unless encrypt is set.
+func (c *Cnf) AddTemplate(name, template string, encrypt bool) error {
+	if _, err := References(template); err != nil {
+		return fmt.Errorf("invalid template for %s: %v", name, err)
+	}
+	if encrypt {
+		if err := c.Add(name, template); err != nil {
+			return err
+		}
+		c.root.Environment[len(c.root.Environment)-1].Interpolate = true
+		return nil
+	}
+	v := yamlEnvVar{Name: name, Template: template, Created: timestamp()}
+	c.root.Environment = append(c.root.Environment, v)
+	return nil
+}
+
+// AddPlain adds a variable that isn't secret. Its value is stored as
+// plaintext, so it is readable without the private key and can be added
+// without the public key.
+func (c *Cnf) AddPlain(name, value string) error {
+	v := yamlEnvVar{Name: name, Value: &value, Created: timestamp()}
+	c.root.Environment = append(c.root.Environment, v)
+	return nil
+}
+
+// AddFile adds a variable whose value is the content of a file. Content of
+// any size is encrypted.
+func (c *Cnf) AddFile(name string, content []byte) error {
+	cipherText, err := c.cipher.EncryptBytes(content)
+	if err != nil {
+		return fmt.Errorf("couldn't encrypt %s: %v", name, err)
+	}
+	v := yamlEnvVar{Name: name, EncryptedFile: cipherText, Key: c.fingerprint(), Created: timestamp()}
+	c.root.Environment = append(c.root.Environment, v)
+	return nil
+}
+
+// SetCipher sets the cipher used to encrypt and decrypt values. A Cnf
+// without encrypted values doesn't need one.
+func (c *Cnf) SetCipher(e cipher) {
+	c.cipher = e
+}
+
+// Encrypted reports whether any value is encrypted, so that decrypting the
+// environment needs the private key.
+func (c *Cnf) Encrypted() bool {
+	for _, envVar := range c.root.Environment {
+		if envVar.EncryptedValue != "" || envVar.EncryptedFile != "" || len(envVar.EncryptedFor) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (v yamlEnvVar) kinds() int {
+	n := 0
+	if v.EncryptedValue != "" {
+		n++
+	}
+	if v.Value != nil {
+		n++
+	}
+	if v.Template != "" {
+		n++
+	}
+	if v.EncryptedFile != "" {
+		n++
+	}
+	if len(v.EncryptedFor) > 0 {
+		n++
+	}
+	return n
+}
+
+func (c *Cnf) decrypt(envVar yamlEnvVar) (rawValue, error) {
+	if envVar.kinds() != 1 {
+		return rawValue{}, fmt.Errorf("must have exactly one of encryptedValue, value, template, encryptedFile and encryptedFor")
+	}
+	if envVar.Value != nil {
+		return rawValue{value: *envVar.Value, plain: true}, nil
+	}
+	if envVar.Template != "" {
+		return rawValue{value: envVar.Template, template: true}, nil
+	}
+	if c.cipher == nil {
+		return rawValue{}, ErrNoKey
+	}
+	if l, ok := c.cipher.(lazyCipher); ok {
+		if err := l.Load(); err != nil {
+			return rawValue{}, err
+		}
+	}
+	if len(envVar.EncryptedFor) > 0 {
+		return c.decryptForGroups(envVar)
+	}
+	if have := c.fingerprint(); envVar.Key != "" && have != "" && have != envVar.Key {
+		return rawValue{}, fmt.Errorf("%w: encrypted for key %s, you have %s", ErrWrongKey, envVar.Key, have)
+	}
+	if envVar.EncryptedFile != "" {
+		content, err := c.cipher.DecryptBytes(envVar.EncryptedFile)
+		if err != nil {
+			return rawValue{}, err
+		}
+		return rawValue{value: string(content), file: true}, nil
+	}
+	val, err := c.cipher.Decrypt(envVar.EncryptedValue)
+	if err != nil {
+		return rawValue{}, err
+	}
+	return rawValue{value: val, template: envVar.Interpolate}, nil
+}
+
+// open decrypts envVar like decrypt, but returns a value that is marked
+// unreadable rather than an error when the key isn't among its recipients.
+func (c *Cnf) open(envVar yamlEnvVar) (rawValue, error) {
+	val, err := c.decrypt(envVar)
+	if errors.Is(err, ErrNoAccess) {
+		return rawValue{denied: true}, nil
+	}
+	return val, err
+}
+
+// DecryptEnvironment decrypts every variable and then expands templates,
+// resolving the variables they refer to first. Variables the cipher's key
+// can't read are returned as Unreadable.
 func (c *Cnf) DecryptEnvironment() ([]EnvVar, error) {
-	env := make([]EnvVar, 0)
+	values := make([]rawValue, 0, len(c.root.Environment))
 	for _, envVar := range c.root.Environment {
-		val, err := c.cipher.Decrypt(envVar.EncryptedValue)
+		val, err := c.open(envVar)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't decrypt %s: %v", envVar.Name, err)
+			return nil, fmt.Errorf("couldn't decrypt %s: %w", envVar.Name, err)
 		}
-		env = append(env, EnvVar{Name: envVar.Name, Value: val})
+		values = append(values, val)
 	}
-	return env, nil
+	return c.resolve(values)
 }
 
-func New(yamlPath string, e cipher) (Cnf, error) {
-	c := Cnf{cipher: e}
-	y, err := ioutil.ReadFile(yamlPath)
+// Parse reads a configuration of any supported version from r. Use
+// SetCipher to give it a cipher.
+func Parse(r io.Reader) (Cnf, error) {
+	var c Cnf
+	y, err := ioutil.ReadAll(r)
 	if err != nil {
-		return c, fmt.Errorf("couldn't open yml: %v", err)
+		return c, fmt.Errorf("couldn't read yml: %v", err)
 	}
-	err = yaml.Unmarshal(y, &c.root)
+	c.root, c.fileVersion, err = parse(y)
 	if err != nil {
-		return c, fmt.Errorf("couldn't unmarshall yaml: %v", err)
+		return c, err
 	}
 	return c, nil
 }
+
+func New(yamlPath string, e cipher) (Cnf, error) {
+	f, err := os.Open(yamlPath)
+	if os.IsNotExist(err) {
+		return Cnf{cipher: e}, fmt.Errorf("couldn't open yml: %s %w", yamlPath, ErrNotFound)
+	}
+	if err != nil {
+		return Cnf{cipher: e}, fmt.Errorf("couldn't open yml: %v", err)
+	}
+	defer f.Close()
+	c, err := Parse(f)
+	c.cipher = e
+	return c, err
+}
+
+// FileVersion returns the version of the format the file was written in.
+// New migrates older versions to CurrentVersion; they are only upgraded on
+// disk when the file is saved.
+func (c *Cnf) FileVersion() int {
+	return c.fileVersion
+}
@@ -6,9 +6,11 @@
 package cnf
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -45,6 +47,14 @@ func (m MockCipher) Encrypt(plainText string) (string, error) {
 	return "foo" + plainText, nil
 }
 
+func (m MockCipher) DecryptBytes(cipherText string) ([]byte, error) {
+	return []byte(cipherText + "bar"), nil
+}
+
+func (m MockCipher) EncryptBytes(plainText []byte) (string, error) {
+	return "foo" + string(plainText), nil
+}
+
 func TestDecryptEnvironment(t *testing.T) {
 	dir, yamlFilePath, err := writeTestFiles()
 	if err != nil {
@@ -117,7 +127,7 @@ func TestSave(t *testing.T) {
 		t.Fatalf("couldn't create Cnf with New: %v", err)
 	}
 
-	cnf.root.Version = 12345
+	cnf.root.Environment[0].Name = "CHANGED"
 	cnf.Save(yamlFilePath)
 
 	cnf, err = New(yamlFilePath, MockCipher{})
@@ -125,7 +135,226 @@ func TestSave(t *testing.T) {
 		t.Fatalf("reloading Cnf with New failed: %v", err)
 	}
 
-	if cnf.root.Version != 12345 {
+	if cnf.root.Environment[0].Name != "CHANGED" {
 		t.Fatal("changes to cnf didn't persist")
 	}
 }
+
+func TestNames(t *testing.T) {
+	dir, yamlFilePath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cnf, err := New(yamlFilePath, nil)
+	if err != nil {
+		t.Fatalf("couldn't create Cnf with New: %v", err)
+	}
+	cnf.root.Environment = append(cnf.root.Environment,
+		yamlEnvVar{Name: "BAR"}, yamlEnvVar{Name: "FOO"})
+
+	names := cnf.Names()
+	if len(names) != 2 || names[0] != "FOO" || names[1] != "BAR" {
+		t.Fatalf("names should be FOO and BAR; are %v", names)
+	}
+}
+
+func TestAddPlain(t *testing.T) {
+	dir, yamlFilePath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cnf, err := New(yamlFilePath, nil)
+	if err != nil {
+		t.Fatalf("couldn't create Cnf with New: %v", err)
+	}
+	cnf.root.Environment = nil
+	if err = cnf.AddPlain("REGION", "us-east-1"); err != nil {
+		t.Fatalf("couldn't add plaintext variable: %v", err)
+	}
+	if err = cnf.AddPlain("EMPTY", ""); err != nil {
+		t.Fatalf("couldn't add empty plaintext variable: %v", err)
+	}
+	if cnf.Encrypted() {
+		t.Fatal("plaintext variables aren't encrypted")
+	}
+	if err = cnf.Save(yamlFilePath); err != nil {
+		t.Fatalf("couldn't save: %v", err)
+	}
+
+	cnf, err = New(yamlFilePath, nil)
+	if err != nil {
+		t.Fatalf("reloading Cnf with New failed: %v", err)
+	}
+	environment, err := cnf.DecryptEnvironment()
+	if err != nil {
+		t.Fatalf("plaintext variables shouldn't need a key: %v", err)
+	}
+	if len(environment) != 2 {
+		t.Fatalf("environment should contain two variables; contains %d", len(environment))
+	}
+	if environment[0].Value != "us-east-1" || !environment[0].Plain {
+		t.Fatalf("unexpected REGION: %v", environment[0])
+	}
+	if environment[1].Value != "" || !environment[1].Plain {
+		t.Fatalf("unexpected EMPTY: %v", environment[1])
+	}
+}
+
+func TestDecryptEnvironmentRejectsAmbiguousValues(t *testing.T) {
+	value := "plain"
+	c := Cnf{cipher: MockCipher{}, root: yamlRoot{Environment: []yamlEnvVar{
+		{Name: "FOO", EncryptedValue: "foo", Value: &value},
+	}}}
+	if _, err := c.DecryptEnvironment(); err == nil {
+		t.Fatal("a variable with both an encrypted and a plaintext value should be rejected")
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	c := Cnf{cipher: IdentityCipher{}}
+	content := []byte{0, 1, 2, '\n', 0xff}
+	if err := c.AddFile("KEYSTORE", content); err != nil {
+		t.Fatalf("couldn't add file: %v", err)
+	}
+	c.AddTemplate("BROKEN", "${KEYSTORE}", false)
+	if !c.Encrypted() {
+		t.Fatal("files are encrypted")
+	}
+	if v := c.root.minimumVersion(); v != 5 {
+		t.Fatalf("files need version 5; got %d", v)
+	}
+	if _, err := c.DecryptEnvironment(); err == nil || !strings.Contains(err.Error(), "KEYSTORE is a file") {
+		t.Fatalf("templates shouldn't refer to files; got %v", err)
+	}
+
+	c.root.Environment = c.root.Environment[:1]
+	environment, err := c.DecryptEnvironment()
+	if err != nil {
+		t.Fatalf("couldn't decrypt environment: %v", err)
+	}
+	if !environment[0].File || environment[0].Value != string(content) {
+		t.Fatalf("unexpected KEYSTORE: %v", environment[0])
+	}
+
+	if err = c.Set("KEYSTORE", "rotated"); err != nil {
+		t.Fatalf("couldn't set file: %v", err)
+	}
+	if c.root.Environment[0].EncryptedFile != "rotated" {
+		t.Fatalf("Set should keep the variable a file: %v", c.root.Environment[0])
+	}
+}
+
+func TestParseAndWriteTo(t *testing.T) {
+	c, err := Parse(strings.NewReader(string(yamlFileContent)))
+	if err != nil {
+		t.Fatalf("couldn't parse: %v", err)
+	}
+	if err = c.AddPlain("REGION", "us-east-1"); err != nil {
+		t.Fatalf("couldn't add plaintext variable: %v", err)
+	}
+	var out strings.Builder
+	n, err := c.WriteTo(&out)
+	if err != nil {
+		t.Fatalf("couldn't write: %v", err)
+	}
+	if n != int64(out.Len()) {
+		t.Fatalf("WriteTo reported %d bytes; wrote %d", n, out.Len())
+	}
+
+	c, err = Parse(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("couldn't parse written configuration: %v", err)
+	}
+	if names := strings.Join(c.Names(), " "); names != "FOO REGION" {
+		t.Fatalf("unexpected names: %s", names)
+	}
+	if c.FileVersion() != 4 {
+		t.Fatalf("plaintext values should be written as version 4; got %d", c.FileVersion())
+	}
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	if _, err := New(filepath.Join(os.TempDir(), "bens-missing.yml"), nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing file, got %v", err)
+	}
+	c := Cnf{}
+	if _, err := c.Metadata("MISSING"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing variable, got %v", err)
+	}
+	c.root.Environment = []yamlEnvVar{{Name: "FOO", EncryptedValue: "foo"}}
+	if _, err := c.DecryptEnvironment(); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("expected ErrNoKey without a cipher, got %v", err)
+	}
+}
+
+type KeyedCipher struct {
+	IdentityCipher
+	fingerprint string
+}
+
+func (k KeyedCipher) Fingerprint() string {
+	return k.fingerprint
+}
+
+func TestWrongKey(t *testing.T) {
+	c := Cnf{cipher: KeyedCipher{fingerprint: "SHA256:a"}}
+	c.Add("FOO", "foo")
+	c.AddFile("BAR", []byte("bar"))
+	c.AddPlain("BAZ", "baz")
+	for _, envVar := range c.root.Environment[:2] {
+		if envVar.Key != "SHA256:a" {
+			t.Fatalf("%s should record the key it was encrypted for; has %q", envVar.Name, envVar.Key)
+		}
+	}
+	if c.root.Environment[2].Key != "" {
+		t.Fatalf("plaintext values shouldn't record a key; has %q", c.root.Environment[2].Key)
+	}
+	if _, err := c.DecryptEnvironment(); err != nil {
+		t.Fatalf("couldn't decrypt with the same key: %v", err)
+	}
+
+	c.SetCipher(KeyedCipher{fingerprint: "SHA256:b"})
+	_, err := c.DecryptEnvironment()
+	if !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "encrypted for key SHA256:a, you have SHA256:b") {
+		t.Fatalf("error should name both keys: %v", err)
+	}
+
+	// Rotating a value re-encrypts it for the current key.
+	c.Set("FOO", "foo2")
+	c.Set("BAR", "bar2")
+	if _, err = c.DecryptEnvironment(); err != nil {
+		t.Fatalf("couldn't decrypt rotated values: %v", err)
+	}
+
+	// Values that don't record a key are decrypted with any key.
+	c.root.Environment[0].Key = ""
+	c.SetCipher(KeyedCipher{fingerprint: "SHA256:c"})
+	if _, err = c.decrypt(c.root.Environment[0]); err != nil {
+		t.Fatalf("values without a key should decrypt: %v", err)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	c := Cnf{cipher: KeyedCipher{fingerprint: "SHA256:a"}}
+	c.Add("FOO", "foo")
+	c.AddPlain("BAZ", "baz")
+	if err := c.CheckKey("NEW"); err != nil {
+		t.Fatalf("the same key should be accepted: %v", err)
+	}
+
+	c.SetCipher(KeyedCipher{fingerprint: "SHA256:b"})
+	err := c.CheckKey("NEW")
+	if !errors.Is(err, ErrWrongKey) || !strings.Contains(err.Error(), "FOO is encrypted for key SHA256:a, the public key is SHA256:b") {
+		t.Fatalf("expected ErrWrongKey naming FOO, got %v", err)
+	}
+	if err = c.CheckKey("FOO"); err != nil {
+		t.Fatalf("the value being replaced should be ignored: %v", err)
+	}
+}
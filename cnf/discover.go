@@ -0,0 +1,44 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// FileName is the name of the configuration file.
+const FileName = "bens.yml"
+
+// DirName is the name of a directory that holds the configuration file and
+// keys of a project, so they needn't clutter its root.
+const DirName = ".bens"
+
+// Find looks for the directory that holds the configuration the way git
+// finds .git: starting at dir and walking up to the root of the file system,
+// the first directory containing a .bens directory or a bens.yml wins. It
+// returns the .bens directory or the directory containing bens.yml, or ""
+// if there is neither.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		bensDir := filepath.Join(dir, DirName)
+		if info, err := os.Stat(bensDir); err == nil && info.IsDir() {
+			return bensDir, nil
+		}
+		if info, err := os.Stat(filepath.Join(dir, FileName)); err == nil && !info.IsDir() {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bens-find")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// Resolve symlinks such as /tmp on macOS so paths compare equal.
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatalf("couldn't resolve temp dir: %v", err)
+	}
+
+	deep := filepath.Join(dir, "project", "service", "src")
+	if err = os.MkdirAll(deep, 0700); err != nil {
+		t.Fatalf("couldn't create dirs: %v", err)
+	}
+	if found, err := Find(deep); err != nil || strings.HasPrefix(found, dir) {
+		t.Fatalf("nothing should be found; got %s, %v", found, err)
+	}
+
+	project := filepath.Join(dir, "project")
+	if err = ioutil.WriteFile(filepath.Join(project, FileName), nil, 0600); err != nil {
+		t.Fatalf("couldn't write %s: %v", FileName, err)
+	}
+	if found, err := Find(deep); err != nil || found != project {
+		t.Fatalf("expected %s; got %s, %v", project, found, err)
+	}
+
+	service := filepath.Join(project, "service", DirName)
+	if err = os.Mkdir(service, 0700); err != nil {
+		t.Fatalf("couldn't create %s: %v", DirName, err)
+	}
+	if found, err := Find(deep); err != nil || found != service {
+		t.Fatalf("expected %s; got %s, %v", service, found, err)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import "errors"
+
+// Errors returned by the cnf package, possibly wrapped. Test for them with
+// errors.Is. Errors from the cipher are wrapped too.
+var (
+	// ErrNotFound is returned when a configuration file or a variable
+	// doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUnsupportedVersion is returned for files written by a newer bens.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrNoKey is returned when decrypting without a cipher.
+	ErrNoKey = errors.New("no key to decrypt it with")
+	// ErrWrongKey is returned when a value was encrypted for another key
+	// than the one decrypting it.
+	ErrWrongKey = errors.New("wrong key")
+	// ErrNoAccess is returned when a variable is restricted to groups that
+	// the key decrypting it isn't a member of.
+	ErrNoAccess = errors.New("not a recipient")
+)
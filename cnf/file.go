@@ -0,0 +1,98 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileLock is an advisory lock on a configuration file, held across a
+// read-modify-write cycle so concurrent bens processes don't lose each
+// other's updates.
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile waits for an exclusive lock on yamlPath. The lock is taken on a
+// separate yamlPath.lock file because Save replaces yamlPath with a new
+// file. The lock file is left behind on Unlock; removing it would let two
+// processes lock different files.
+func LockFile(yamlPath string) (*FileLock, error) {
+	f, err := os.OpenFile(yamlPath+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f: f}, nil
+}
+
+func (l *FileLock) Unlock() error {
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeFileAtomic replaces path with data so that readers see either the
+// old or the new content, even if bens crashes part way through. An existing
+// file keeps its permissions and, where possible, its owner. Symlinks are
+// followed so the link itself isn't replaced.
+func writeFileAtomic(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0644)
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if err = writeAndSync(tmp, data); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Chmod(tmpPath, mode); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if info != nil {
+		if err = chownLike(tmpPath, info); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return syncDir(dir)
+}
+
+func writeAndSync(f *os.File, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
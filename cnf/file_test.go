@@ -0,0 +1,88 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSavePreservesMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows doesn't have unix permissions")
+	}
+	dir, yamlFilePath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.Chmod(yamlFilePath, 0600); err != nil {
+		t.Fatalf("couldn't chmod: %v", err)
+	}
+	cnf, err := New(yamlFilePath, MockCipher{})
+	if err != nil {
+		t.Fatalf("couldn't create Cnf with New: %v", err)
+	}
+	if err = cnf.Save(yamlFilePath); err != nil {
+		t.Fatalf("couldn't save: %v", err)
+	}
+
+	info, err := os.Stat(yamlFilePath)
+	if err != nil {
+		t.Fatalf("couldn't stat: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("mode should still be 0600; is %v", info.Mode().Perm())
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("temporary files were left behind: %d files", len(files))
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	dir, yamlFilePath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	lock, err := LockFile(yamlFilePath)
+	if err != nil {
+		t.Fatalf("couldn't lock: %v", err)
+	}
+
+	locked := make(chan *FileLock)
+	go func() {
+		l, err := LockFile(yamlFilePath)
+		if err != nil {
+			t.Errorf("couldn't lock a second time: %v", err)
+		}
+		locked <- l
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("second lock shouldn't be granted while the first is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err = lock.Unlock(); err != nil {
+		t.Fatalf("couldn't unlock: %v", err)
+	}
+	select {
+	case l := <-locked:
+		if l != nil {
+			l.Unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock wasn't granted after unlock")
+	}
+}
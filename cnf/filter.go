@@ -0,0 +1,65 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter selects variables by name and renames the ones it selects. Only
+// and Exclude hold glob patterns such as APP_* in the syntax of path.Match.
+// The zero Filter selects every variable and renames none.
+type Filter struct {
+	// Only selects the variables that match any of its patterns. An empty
+	// Only selects every variable.
+	Only []string
+	// Exclude drops the variables that match any of its patterns.
+	Exclude []string
+	// Prefix selects the variables whose names start with it.
+	Prefix string
+
+	// StripPrefix is removed from the start of selected names that have it,
+	// and then AddPrefix is added to every selected name.
+	StripPrefix string
+	AddPrefix   string
+}
+
+// Validate reports a malformed pattern.
+func (f Filter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Only...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the filter selects the variable name.
+func (f Filter) Match(name string) bool {
+	if !strings.HasPrefix(name, f.Prefix) {
+		return false
+	}
+	if len(f.Only) > 0 && !matchAny(f.Only, name) {
+		return false
+	}
+	return !matchAny(f.Exclude, name)
+}
+
+// Rename returns the name a selected variable is given.
+func (f Filter) Rename(name string) string {
+	return f.AddPrefix + strings.TrimPrefix(name, f.StripPrefix)
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	for _, test := range []struct {
+		filter   Filter
+		name     string
+		expected bool
+	}{
+		{Filter{}, "ANY", true},
+		{Filter{Only: []string{"FOO", "BAR"}}, "BAR", true},
+		{Filter{Only: []string{"FOO", "BAR"}}, "BAZ", false},
+		{Filter{Only: []string{"APP_*"}}, "APP_PORT", true},
+		{Filter{Only: []string{"APP_*"}}, "DB_PORT", false},
+		{Filter{Exclude: []string{"*_KEY"}}, "API_KEY", false},
+		{Filter{Exclude: []string{"*_KEY"}}, "API_URL", true},
+		{Filter{Prefix: "APP_"}, "APP_PORT", true},
+		{Filter{Prefix: "APP_"}, "PORT", false},
+		{Filter{Prefix: "APP_", Exclude: []string{"APP_DEBUG"}}, "APP_DEBUG", false},
+	} {
+		if got := test.filter.Match(test.name); got != test.expected {
+			t.Errorf("%+v matching %s: expected %v; got %v", test.filter, test.name, test.expected, got)
+		}
+	}
+	if err := (Filter{Only: []string{"["}}).Validate(); err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
+
+func TestFilterRename(t *testing.T) {
+	f := Filter{StripPrefix: "APP_", AddPrefix: "TF_VAR_"}
+	if got := f.Rename("APP_PORT"); got != "TF_VAR_PORT" {
+		t.Fatalf("expected TF_VAR_PORT; got %s", got)
+	}
+	if got := f.Rename("REGION"); got != "TF_VAR_REGION" {
+		t.Fatalf("expected TF_VAR_REGION; got %s", got)
+	}
+}
+
+func TestDecryptLayersMatching(t *testing.T) {
+	c := Cnf{cipher: FailingCipher{}}
+	c.Add("APP_USER", "user")
+	c.Add("APP_PASS", "pass")
+	c.AddTemplate("APP_URL", "https://${APP_USER}:${DB_HOST}", false)
+	c.AddPlain("DB_HOST", "db")
+	// Decrypting this would fail, so it mustn't be decrypted unless it is
+	// selected.
+	c.Add("OTHER", "bad")
+
+	layers := []Layer{{Path: "bens.yml", Cnf: c}}
+	f := Filter{Prefix: "APP_", Exclude: []string{"*_PASS"}, StripPrefix: "APP_", AddPrefix: "SVC_"}
+	environment, err := DecryptLayersMatching(layers, f)
+	if err != nil {
+		t.Fatalf("couldn't decrypt layers: %v", err)
+	}
+	var got []string
+	for _, envVar := range environment {
+		got = append(got, envVar.Name+"="+envVar.Value)
+	}
+	expected := "SVC_USER=user SVC_URL=https://user:db"
+	if strings.Join(got, " ") != expected {
+		t.Fatalf("expected %s; got %s", expected, strings.Join(got, " "))
+	}
+
+	if _, err = DecryptLayersMatching(layers, Filter{Only: []string{"OTHER"}}); err == nil {
+		t.Fatal("expected selected values to be decrypted")
+	}
+
+}
+
+func TestDecryptLayersMatchingRenameCollision(t *testing.T) {
+	var base, service Cnf
+	base.AddPlain("FOO", "base")
+	service.AddPlain("APP_FOO", "service")
+	layers := []Layer{{Path: "base.yml", Cnf: base}, {Path: "bens.yml", Cnf: service}}
+	_, err := DecryptLayersMatching(layers, Filter{StripPrefix: "APP_"})
+	if err == nil || !strings.Contains(err.Error(), "FOO and APP_FOO would both be named FOO") {
+		t.Fatalf("expected a rename collision; got %v", err)
+	}
+}
+
+func TestDecryptLayersMatchingOverridden(t *testing.T) {
+	// The root layer's values can't be decrypted, but they are overridden.
+	root := Cnf{cipher: FailingCipher{}}
+	root.Add("DB_PASS", "root")
+	root.AddPlain("DB_HOST", "db")
+	root.Add("DB_USER", "root")
+	var service Cnf
+	service.AddPlain("DB_PASS", "service")
+	service.AddPlain("DB_USER", "service")
+	layers := []Layer{{Path: "root.yml", Cnf: root}, {Path: "bens.yml", Cnf: service}}
+
+	environment, err := DecryptLayersMatching(layers, Filter{Only: []string{"DB_PASS", "DB_USER", "DB_HOST"}})
+	if err != nil {
+		t.Fatalf("overridden values mustn't be decrypted: %v", err)
+	}
+	var got []string
+	for _, envVar := range environment {
+		got = append(got, envVar.Name+"="+envVar.Value+"@"+envVar.Source)
+	}
+	expected := "DB_PASS=service@bens.yml DB_HOST=db@root.yml DB_USER=service@bens.yml"
+	if strings.Join(got, " ") != expected {
+		t.Fatalf("expected %s; got %s", expected, strings.Join(got, " "))
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/highfidelity/bens/key"
+)
+
+// yamlRecipient is somebody who can be given access to variables, by the
+// PEM encoded public key of their key pair.
+type yamlRecipient struct {
+	Name      string
+	PublicKey string `yaml:"publicKey"`
+}
+
+// yamlGroup names a set of recipients.
+type yamlGroup struct {
+	Name       string
+	Recipients []string
+}
+
+// yamlRecipientValue is a value encrypted for one recipient, identified by
+// the fingerprint of their key.
+type yamlRecipientValue struct {
+	Key            string
+	EncryptedValue string `yaml:"encryptedValue,omitempty"`
+	EncryptedFile  string `yaml:"encryptedFile,omitempty"`
+}
+
+// AddRecipient adds a recipient with the PEM encoded public key publicKey,
+// or replaces the key of the recipient with that name, and adds them to
+// groups, creating the groups that don't exist. Values already encrypted for
+// the groups are only encrypted for the recipient once they are set again.
+func (c *Cnf) AddRecipient(name string, publicKey []byte, groups []string) error {
+	if _, err := key.FromPEM(nil, publicKey, nil); err != nil {
+		return fmt.Errorf("invalid public key for %s: %w", name, err)
+	}
+	found := false
+	for i := range c.root.Recipients {
+		if c.root.Recipients[i].Name == name {
+			c.root.Recipients[i].PublicKey = string(publicKey)
+			found = true
+		}
+	}
+	if !found {
+		c.root.Recipients = append(c.root.Recipients, yamlRecipient{Name: name, PublicKey: string(publicKey)})
+	}
+
+	for _, group := range groups {
+		i := c.group(group)
+		if i < 0 {
+			c.root.Groups = append(c.root.Groups, yamlGroup{Name: group})
+			i = len(c.root.Groups) - 1
+		}
+		g := &c.root.Groups[i]
+		member := false
+		for _, recipient := range g.Recipients {
+			member = member || recipient == name
+		}
+		if !member {
+			g.Recipients = append(g.Recipients, name)
+		}
+	}
+	return nil
+}
+
+// group returns the index of the group name, or -1.
+func (c *Cnf) group(name string) int {
+	for i, g := range c.root.Groups {
+		if g.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// recipientKeys returns the keys of the members of groups, each once.
+func (c *Cnf) recipientKeys(groups []string) ([]key.Key, error) {
+	publicKeys := make(map[string]string, len(c.root.Recipients))
+	for _, recipient := range c.root.Recipients {
+		publicKeys[recipient.Name] = recipient.PublicKey
+	}
+	var keys []key.Key
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		i := c.group(group)
+		if i < 0 {
+			return nil, fmt.Errorf("group %s %w", group, ErrNotFound)
+		}
+		for _, name := range c.root.Groups[i].Recipients {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			publicKey, ok := publicKeys[name]
+			if !ok {
+				return nil, fmt.Errorf("recipient %s of group %s %w", name, group, ErrNotFound)
+			}
+			k, err := key.FromPEM(nil, []byte(publicKey), nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key for %s: %w", name, err)
+			}
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("groups %s have no recipients", strings.Join(groups, ", "))
+	}
+	return keys, nil
+}
+
+// encryptFor encrypts content for every member of groups, as a file if file
+// is set.
+func (c *Cnf) encryptFor(groups []string, content []byte, file bool) ([]yamlRecipientValue, error) {
+	keys, err := c.recipientKeys(groups)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]yamlRecipientValue, 0, len(keys))
+	for _, k := range keys {
+		v := yamlRecipientValue{Key: k.Fingerprint()}
+		if file {
+			v.EncryptedFile, err = k.EncryptBytes(content)
+		} else {
+			v.EncryptedValue, err = k.Encrypt(string(content))
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// AddForGroups adds a variable that only the members of groups can
+// decrypt. It doesn't need a cipher.
+func (c *Cnf) AddForGroups(name, value string, groups []string) error {
+	return c.addForGroups(name, []byte(value), groups, false)
+}
+
+// AddFileForGroups adds a file that only the members of groups can decrypt,
+// like AddFile.
+func (c *Cnf) AddFileForGroups(name string, content []byte, groups []string) error {
+	return c.addForGroups(name, content, groups, true)
+}
+
+func (c *Cnf) addForGroups(name string, content []byte, groups []string, file bool) error {
+	values, err := c.encryptFor(groups, content, file)
+	if err != nil {
+		return fmt.Errorf("couldn't encrypt %s: %w", name, err)
+	}
+	v := yamlEnvVar{Name: name, Groups: groups, EncryptedFor: values, Created: timestamp()}
+	c.root.Environment = append(c.root.Environment, v)
+	return nil
+}
+
+// decryptForGroups decrypts the copy of a value encrypted for the cipher's
+// key. A cipher that can't tell its key tries every copy.
+func (c *Cnf) decryptForGroups(envVar yamlEnvVar) (rawValue, error) {
+	have := c.fingerprint()
+	for _, v := range envVar.EncryptedFor {
+		if have != "" && v.Key != have {
+			continue
+		}
+		var val rawValue
+		var err error
+		if v.EncryptedFile != "" {
+			var content []byte
+			content, err = c.cipher.DecryptBytes(v.EncryptedFile)
+			val = rawValue{value: string(content), file: true}
+		} else {
+			val.value, err = c.cipher.Decrypt(v.EncryptedValue)
+		}
+		if err == nil {
+			return val, nil
+		}
+		// Without a fingerprint the only way to find our copy is to try
+		// them all, but a key that can't decrypt at all must be reported.
+		if have != "" || !(errors.Is(err, key.ErrTampered) || errors.Is(err, ErrWrongKey)) {
+			return rawValue{}, err
+		}
+	}
+	return rawValue{}, fmt.Errorf("%w; readable by %s", ErrNoAccess, strings.Join(envVar.Groups, ", "))
+}
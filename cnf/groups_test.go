@@ -0,0 +1,142 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/highfidelity/bens/key"
+)
+
+// generateKey returns a new key that can decrypt and its PEM encoded public
+// key.
+func generateKey(t *testing.T) (key.Key, []byte) {
+	pass := []byte("pass")
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %v", err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY",
+		x509.MarshalPKCS1PrivateKey(private), pass, x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("couldn't encrypt key: %v", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("couldn't marshal public key: %v", err)
+	}
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+	k, err := key.FromPEM(pem.EncodeToMemory(block), pub, pass)
+	if err != nil {
+		t.Fatalf("couldn't load key: %v", err)
+	}
+	return k, pub
+}
+
+func TestGroups(t *testing.T) {
+	alice, alicePub := generateKey(t)
+	bob, bobPub := generateKey(t)
+
+	var c Cnf
+	if err := c.AddRecipient("alice", alicePub, []string{"payments", "frontend"}); err != nil {
+		t.Fatalf("couldn't add alice: %v", err)
+	}
+	if err := c.AddRecipient("bob", bobPub, []string{"frontend"}); err != nil {
+		t.Fatalf("couldn't add bob: %v", err)
+	}
+	if err := c.AddRecipient("mallory", []byte("not a key"), nil); err == nil {
+		t.Fatal("expected an error for an invalid public key")
+	}
+	if err := c.AddForGroups("STRIPE_KEY", "sk", []string{"payments"}); err != nil {
+		t.Fatalf("couldn't add to payments: %v", err)
+	}
+	if err := c.AddFileForGroups("CERT", []byte("cert"), []string{"frontend"}); err != nil {
+		t.Fatalf("couldn't add to frontend: %v", err)
+	}
+	if err := c.AddTemplate("STRIPE_URL", "https://${STRIPE_KEY}@stripe", false); err != nil {
+		t.Fatalf("couldn't add template: %v", err)
+	}
+	if err := c.AddForGroups("NOBODY", "x", []string{"missing"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing group, got %v", err)
+	}
+
+	// The file survives a round trip.
+	var out bytes.Buffer
+	if _, err := c.WriteTo(&out); err != nil {
+		t.Fatalf("couldn't write: %v", err)
+	}
+	c, err := Parse(&out)
+	if err != nil {
+		t.Fatalf("couldn't parse: %v", err)
+	}
+	if c.FileVersion() != 8 {
+		t.Fatalf("groups need version 8; got %d", c.FileVersion())
+	}
+
+	c.SetCipher(&alice)
+	environment, err := c.DecryptEnvironment()
+	if err != nil {
+		t.Fatalf("alice couldn't decrypt: %v", err)
+	}
+	for i, expected := range []EnvVar{
+		{Name: "STRIPE_KEY", Value: "sk"},
+		{Name: "CERT", Value: "cert", File: true},
+		{Name: "STRIPE_URL", Value: "https://sk@stripe"},
+	} {
+		if environment[i] != expected {
+			t.Fatalf("expected %v; got %v", expected, environment[i])
+		}
+	}
+
+	// Bob can't read payments, nor the template that refers to it, but
+	// still gets the rest.
+	c.SetCipher(&bob)
+	if environment, err = c.DecryptEnvironment(); err != nil {
+		t.Fatalf("bob couldn't decrypt: %v", err)
+	}
+	if !environment[0].Unreadable || environment[1].Unreadable || environment[1].Value != "cert" || !environment[2].Unreadable {
+		t.Fatalf("unexpected environment for bob: %v", environment)
+	}
+	problems := c.Check()
+	if len(problems) != 1 || problems[0].Name != "STRIPE_KEY" || !problems[0].Warning {
+		t.Fatalf("expected a warning for STRIPE_KEY; got %v", problems)
+	}
+
+	// Adding bob to payments takes effect when the value is set again.
+	c.AddRecipient("bob", bobPub, []string{"payments"})
+	if err = c.Set("STRIPE_KEY", "sk2"); err != nil {
+		t.Fatalf("couldn't set: %v", err)
+	}
+	if environment, err = c.DecryptEnvironment(); err != nil || environment[0].Value != "sk2" {
+		t.Fatalf("bob should read the rotated value; got %v, %v", environment, err)
+	}
+}
+
+func TestGroupsKeyError(t *testing.T) {
+	_, alicePub := generateKey(t)
+
+	var c Cnf
+	if err := c.AddRecipient("alice", alicePub, []string{"payments"}); err != nil {
+		t.Fatalf("couldn't add alice: %v", err)
+	}
+	if err := c.AddForGroups("STRIPE_KEY", "sk", []string{"payments"}); err != nil {
+		t.Fatalf("couldn't add to payments: %v", err)
+	}
+
+	// A key that can't be loaded is reported, not mistaken for no access.
+	c.SetCipher(key.NewLazy(func() (key.Key, error) {
+		return key.Key{}, key.ErrWrongPass
+	}))
+	if _, err := c.DecryptEnvironment(); !errors.Is(err, key.ErrWrongPass) {
+		t.Fatalf("expected ErrWrongPass; got %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// KeyFiles names the key set that decrypts a file. Empty fields mean the key
+// set of the including file or, for files that aren't included, the one
+// chosen on the command line.
+type KeyFiles struct {
+	PassFile       string `yaml:"passFile,omitempty"`
+	PrivateKeyFile string `yaml:"privateKeyFile,omitempty"`
+	PublicKeyFile  string `yaml:"publicKeyFile,omitempty"`
+}
+
+// yamlInclude is another bens.yml whose variables a file builds on. Its
+// paths are relative to the including file.
+type yamlInclude struct {
+	Path     string
+	KeyFiles `yaml:",inline"`
+}
+
+// Layer is one file of a layered environment.
+type Layer struct {
+	Path string
+	Keys KeyFiles
+	Cnf  Cnf
+}
+
+// Inherit fills the unset fields of k from parent.
+func (k KeyFiles) Inherit(parent KeyFiles) KeyFiles {
+	if k.PassFile == "" {
+		k.PassFile = parent.PassFile
+	}
+	if k.PrivateKeyFile == "" {
+		k.PrivateKeyFile = parent.PrivateKeyFile
+	}
+	if k.PublicKeyFile == "" {
+		k.PublicKeyFile = parent.PublicKeyFile
+	}
+	return k
+}
+
+// relativeTo makes the set fields of k relative to dir.
+func (k KeyFiles) relativeTo(dir string) KeyFiles {
+	for _, path := range []*string{&k.PassFile, &k.PrivateKeyFile, &k.PublicKeyFile} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	return k
+}
+
+type loader struct {
+	layers []Layer
+	loaded map[string]bool
+	stack  []string
+}
+
+func (l *loader) load(path string, keys KeyFiles) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for i, p := range l.stack {
+		if p == abs {
+			cycle := append(append([]string{}, l.stack[i:]...), abs)
+			return fmt.Errorf("include cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+	// A file included twice keeps its first, lowest precedence place.
+	if l.loaded[abs] {
+		return nil
+	}
+
+	c, err := New(path, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't load %s: %w", path, err)
+	}
+	l.stack = append(l.stack, abs)
+	dir := filepath.Dir(path)
+	for _, include := range c.root.Includes {
+		if include.Path == "" {
+			return fmt.Errorf("%s has an include without a path", path)
+		}
+		includePath := include.Path
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(dir, includePath)
+		}
+		includeKeys := include.KeyFiles.relativeTo(dir).Inherit(keys)
+		if err := l.load(includePath, includeKeys); err != nil {
+			return err
+		}
+	}
+	l.stack = l.stack[:len(l.stack)-1]
+
+	l.loaded[abs] = true
+	l.layers = append(l.layers, Layer{Path: path, Keys: keys, Cnf: c})
+	return nil
+}
+
+// Load loads the files at paths and the files they include as layers in
+// order of precedence, lowest first: a file's includes come before it, in
+// the order they are listed, and the files at paths come in the order
+// given. Layers loaded this way have no cipher.
+func Load(paths ...string) ([]Layer, error) {
+	l := loader{loaded: make(map[string]bool)}
+	for _, path := range paths {
+		if err := l.load(path, KeyFiles{}); err != nil {
+			return nil, err
+		}
+	}
+	return l.layers, nil
+}
+
+// Source is where a variable of a layered environment comes from.
+type Source struct {
+	Name string
+	Path string
+	// Overrides lists the paths of lower layers that also define the
+	// variable.
+	Overrides []string
+}
+
+// Sources returns the layer that each variable of layers comes from, in
+// the order the variables are first defined. It doesn't need to decrypt
+// anything.
+func Sources(layers []Layer) []Source {
+	var sources []Source
+	index := make(map[string]int)
+	for _, layer := range layers {
+		for _, name := range layer.Cnf.Names() {
+			i, ok := index[name]
+			if !ok {
+				index[name] = len(sources)
+				sources = append(sources, Source{Name: name, Path: layer.Path})
+				continue
+			}
+			sources[i].Overrides = append(sources[i].Overrides, sources[i].Path)
+			sources[i].Path = layer.Path
+		}
+	}
+	return sources
+}
+
+// DecryptLayers decrypts every layer with its own cipher and merges them.
+// A variable defined in several layers takes its value from the last one
+// but keeps the place where it was first defined; the definitions it
+// overrides aren't decrypted. Templates can refer to
+// variables of any layer.
+func DecryptLayers(layers []Layer) ([]EnvVar, error) {
+	return DecryptLayersMatching(layers, Filter{})
+}
+
+// DecryptLayersMatching decrypts and merges layers like DecryptLayers but
+// only returns the variables that f selects, renamed by f. Only those
+// variables and the ones their templates refer to are decrypted. Two
+// selected variables that f renames to the same name are an error.
+func DecryptLayersMatching(layers []Layer, f Filter) ([]EnvVar, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	type entry struct {
+		layer  int
+		envVar yamlEnvVar
+		value  *rawValue
+	}
+	var entries []entry
+	byName := make(map[string][]int)
+	for i, layer := range layers {
+		for _, envVar := range layer.Cnf.root.Environment {
+			byName[envVar.Name] = append(byName[envVar.Name], len(entries))
+			entries = append(entries, entry{layer: i, envVar: envVar})
+		}
+	}
+
+	// Decrypt the selected variables and then, until there are none left,
+	// the variables their templates refer to. Only the last definition of a
+	// name is used, so overridden ones aren't decrypted.
+	needed := make(map[string]bool)
+	var queue []string
+	for _, e := range entries {
+		if !needed[e.envVar.Name] && f.Match(e.envVar.Name) {
+			needed[e.envVar.Name] = true
+			queue = append(queue, e.envVar.Name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		defs := byName[name]
+		if len(defs) == 0 {
+			continue
+		}
+		e := &entries[defs[len(defs)-1]]
+		layer := layers[e.layer]
+		val, err := layer.Cnf.open(e.envVar)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decrypt %s from %s: %w", name, layer.Path, err)
+		}
+		e.value = &val
+		if !val.template {
+			continue
+		}
+		// Invalid templates are reported when they are resolved.
+		refs, _ := References(val.value)
+		for _, ref := range refs {
+			if !needed[ref] {
+				needed[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+
+	// Variables keep the place of their first definition.
+	var combined Cnf
+	var values []rawValue
+	var paths []string
+	for i, e := range entries {
+		defs := byName[e.envVar.Name]
+		if defs[0] != i {
+			continue
+		}
+		e = entries[defs[len(defs)-1]]
+		if e.value == nil {
+			continue
+		}
+		combined.root.Environment = append(combined.root.Environment, e.envVar)
+		values = append(values, *e.value)
+		paths = append(paths, layers[e.layer].Path)
+	}
+	resolved, err := combined.resolve(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var env []EnvVar
+	renamedFrom := make(map[string]string)
+	for i, envVar := range resolved {
+		if !f.Match(envVar.Name) {
+			continue
+		}
+		name := f.Rename(envVar.Name)
+		if from, ok := renamedFrom[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be named %s", from, envVar.Name, name)
+		}
+		renamedFrom[name] = envVar.Name
+		envVar.Name = name
+		envVar.Source = paths[i]
+		env = append(env, envVar)
+	}
+	return env, nil
+}
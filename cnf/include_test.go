@@ -0,0 +1,116 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLayers(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "bens-include")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("couldn't create dir: %v", err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("couldn't write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadAndDecryptLayers(t *testing.T) {
+	dir := writeLayers(t, map[string]string{
+		"bens.yml": `
+version: 4
+environment:
+  - name: SHARED
+    encryptedValue: shared
+  - name: REGION
+    value: us-east-1
+`,
+		"svc/bens.yml": `
+version: 6
+includes:
+  - path: ../bens.yml
+    publicKeyFile: ../keys/pub.key
+environment:
+  - name: REGION
+    value: eu-west-1
+  - name: URL
+    template: https://${SHARED}@${REGION}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	svc := filepath.Join(dir, "svc", "bens.yml")
+	layers, err := Load(svc)
+	if err != nil {
+		t.Fatalf("couldn't load layers: %v", err)
+	}
+	if len(layers) != 2 || layers[0].Path != filepath.Join(dir, "bens.yml") || layers[1].Path != svc {
+		t.Fatalf("unexpected layers: %v", layers)
+	}
+	if layers[0].Keys.PublicKeyFile != filepath.Join(dir, "keys", "pub.key") || layers[1].Keys != (KeyFiles{}) {
+		t.Fatalf("unexpected keys: %v, %v", layers[0].Keys, layers[1].Keys)
+	}
+
+	layers[0].Cnf.SetCipher(IdentityCipher{})
+	environment, err := DecryptLayers(layers)
+	if err != nil {
+		t.Fatalf("couldn't decrypt layers: %v", err)
+	}
+	var got []string
+	for _, envVar := range environment {
+		got = append(got, envVar.Name+"="+envVar.Value+"@"+filepath.Base(filepath.Dir(envVar.Source)))
+	}
+	expected := "SHARED=shared@" + filepath.Base(dir) + " REGION=eu-west-1@svc URL=https://shared@eu-west-1@svc"
+	if strings.Join(got, " ") != expected {
+		t.Fatalf("expected %s; got %s", expected, strings.Join(got, " "))
+	}
+
+	sources := Sources(layers)
+	if len(sources) != 3 || sources[1].Name != "REGION" || sources[1].Path != svc || len(sources[1].Overrides) != 1 {
+		t.Fatalf("unexpected sources: %v", sources)
+	}
+}
+
+func TestLoadRejectsCycles(t *testing.T) {
+	dir := writeLayers(t, map[string]string{
+		"a.yml": "version: 6\nincludes:\n  - path: b.yml\nenvironment: []\n",
+		"b.yml": "version: 6\nincludes:\n  - path: a.yml\nenvironment: []\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if _, err := Load(filepath.Join(dir, "a.yml")); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected an include cycle error, got %v", err)
+	}
+}
+
+func TestLoadIncludesFilesOnce(t *testing.T) {
+	dir := writeLayers(t, map[string]string{
+		"root.yml": "version: 1\nenvironment: []\n",
+		"a.yml":    "version: 6\nincludes:\n  - path: root.yml\nenvironment: []\n",
+		"b.yml":    "version: 6\nincludes:\n  - path: root.yml\nenvironment: []\n",
+	})
+	defer os.RemoveAll(dir)
+
+	layers, err := Load(filepath.Join(dir, "a.yml"), filepath.Join(dir, "b.yml"))
+	if err != nil {
+		t.Fatalf("couldn't load layers: %v", err)
+	}
+	if len(layers) != 3 {
+		t.Fatalf("root.yml should only be loaded once: %v", layers)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// expand replaces every ${NAME} in template with the value lookup returns
+// for NAME. $$ is a literal $; any other $ is kept as it is. Errors never
+// include the template since it may be secret.
+func expand(template string, lookup func(string) (string, error)) (string, error) {
+	var out bytes.Buffer
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '$' || i+1 == len(template) {
+			out.WriteByte(c)
+			continue
+		}
+		switch template[i+1] {
+		case '$':
+			out.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(template[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ at offset %d", i)
+			}
+			name := template[i+2 : i+2+end]
+			if !isValidName(name) {
+				return "", fmt.Errorf("invalid reference at offset %d", i)
+			}
+			value, err := lookup(name)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i += 2 + end
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
+
+func isValidName(name string) bool {
+	if name == "" || !isNameStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// References returns the names template refers to, in order and without
+// duplicates.
+func References(template string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	_, err := expand(template, func(name string) (string, error) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return "", nil
+	})
+	return names, err
+}
+
+type rawValue struct {
+	value    string
+	template bool
+	plain    bool
+	file     bool
+	// denied is set for values that the key can't decrypt.
+	denied bool
+}
+
+// resolver expands templates on demand, resolving the variables they refer
+// to first and detecting reference cycles.
+type resolver struct {
+	raw      map[string]rawValue
+	resolved map[string]string
+	stack    []string
+}
+
+func (r *resolver) lookup(name string) (string, error) {
+	if value, ok := r.resolved[name]; ok {
+		return value, nil
+	}
+	raw, ok := r.raw[name]
+	if !ok {
+		return "", fmt.Errorf("%s isn't defined", name)
+	}
+	if raw.file {
+		return "", fmt.Errorf("%s is a file", name)
+	}
+	if raw.denied {
+		return "", fmt.Errorf("%s %w", name, ErrNoAccess)
+	}
+	if !raw.template {
+		r.resolved[name] = raw.value
+		return raw.value, nil
+	}
+	for i, n := range r.stack {
+		if n == name {
+			cycle := append(append([]string{}, r.stack[i:]...), name)
+			return "", fmt.Errorf("reference cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	r.stack = append(r.stack, name)
+	value, err := expand(raw.value, r.lookup)
+	r.stack = r.stack[:len(r.stack)-1]
+	if err != nil {
+		return "", err
+	}
+	r.resolved[name] = value
+	return value, nil
+}
+
+// resolve expands the templates among values, which are in the same order
+// as the environment. When a name repeats, references see its last value.
+// Values that can't be decrypted, and templates that refer to them, are
+// returned as Unreadable.
+func (c *Cnf) resolve(values []rawValue) ([]EnvVar, error) {
+	r := resolver{raw: make(map[string]rawValue), resolved: make(map[string]string)}
+	for i, envVar := range c.root.Environment {
+		r.raw[envVar.Name] = values[i]
+	}
+
+	env := make([]EnvVar, 0, len(values))
+	for i, envVar := range c.root.Environment {
+		if values[i].denied {
+			env = append(env, EnvVar{Name: envVar.Name, Unreadable: true})
+			continue
+		}
+		value := values[i].value
+		if values[i].template {
+			var err error
+			r.stack = []string{envVar.Name}
+			value, err = expand(value, r.lookup)
+			if errors.Is(err, ErrNoAccess) {
+				env = append(env, EnvVar{Name: envVar.Name, Unreadable: true})
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("couldn't interpolate %s: %v", envVar.Name, err)
+			}
+		}
+		env = append(env, EnvVar{Name: envVar.Name, Value: value, Plain: values[i].plain, File: values[i].file})
+	}
+	return env, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"strings"
+	"testing"
+)
+
+type IdentityCipher struct{}
+
+func (IdentityCipher) Decrypt(cipherText string) (string, error) { return cipherText, nil }
+func (IdentityCipher) Encrypt(plainText string) (string, error)  { return plainText, nil }
+func (IdentityCipher) DecryptBytes(cipherText string) ([]byte, error) {
+	return []byte(cipherText), nil
+}
+func (IdentityCipher) EncryptBytes(plainText []byte) (string, error) { return string(plainText), nil }
+
+func TestExpand(t *testing.T) {
+	values := map[string]string{"USER": "alice", "HOST": "db"}
+	lookup := func(name string) (string, error) { return values[name], nil }
+
+	v, err := expand("postgres://${USER}@${HOST}/app?cost=$$5&x=$y", lookup)
+	if err != nil {
+		t.Fatalf("couldn't expand: %v", err)
+	}
+	if v != "postgres://alice@db/app?cost=$5&x=$y" {
+		t.Fatalf("unexpected expansion: %s", v)
+	}
+
+	for _, bad := range []string{"${USER", "${}", "${1X}"} {
+		if _, err := expand(bad, lookup); err == nil {
+			t.Fatalf("%s should be rejected", bad)
+		}
+	}
+}
+
+func TestDecryptEnvironmentInterpolates(t *testing.T) {
+	c := Cnf{cipher: IdentityCipher{}}
+	c.AddTemplate("DATABASE_URL", "postgres://${DB_USER}:${DB_PASS}@${DB_HOST}/app", false)
+	c.Add("DB_USER", "alice")
+	c.AddTemplate("DB_PASS", "${SECRET}!", true)
+	c.Add("SECRET", "s3cret")
+	c.Add("DB_HOST", "db")
+
+	env, err := c.DecryptEnvironment()
+	if err != nil {
+		t.Fatalf("couldn't decrypt environment: %v", err)
+	}
+	if env[0].Name != "DATABASE_URL" || env[0].Value != "postgres://alice:s3cret!@db/app" {
+		t.Fatalf("unexpected DATABASE_URL: %v", env[0])
+	}
+	if env[2].Value != "s3cret!" {
+		t.Fatalf("encrypted templates should be expanded: %v", env[2])
+	}
+	if c.root.Environment[0].EncryptedValue != "" || c.root.Environment[2].EncryptedValue == "" {
+		t.Fatal("only encrypted templates should be encrypted")
+	}
+}
+
+func TestDecryptEnvironmentMissingReference(t *testing.T) {
+	c := Cnf{cipher: IdentityCipher{}}
+	c.AddTemplate("URL", "http://${HOST}/", false)
+
+	_, err := c.DecryptEnvironment()
+	if err == nil || !strings.Contains(err.Error(), "URL") || !strings.Contains(err.Error(), "HOST isn't defined") {
+		t.Fatalf("expected a missing reference error, got %v", err)
+	}
+}
+
+func TestDecryptEnvironmentCycle(t *testing.T) {
+	c := Cnf{cipher: IdentityCipher{}}
+	c.AddTemplate("A", "${B}", false)
+	c.AddTemplate("B", "${C}", false)
+	c.AddTemplate("C", "${A}", true)
+
+	_, err := c.DecryptEnvironment()
+	if err == nil || !strings.Contains(err.Error(), "A -> B -> C -> A") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	refs, err := References("${A}${B}${A}$$C")
+	if err != nil {
+		t.Fatalf("couldn't get references: %v", err)
+	}
+	if len(refs) != 2 || refs[0] != "A" || refs[1] != "B" {
+		t.Fatalf("expected A and B, got %v", refs)
+	}
+}
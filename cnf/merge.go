@@ -0,0 +1,169 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+)
+
+// Digests returns every variable with a short SHA-256 digest of its
+// encrypted value in place of the value. Plaintext values and templates are
+// returned as they are. It doesn't need to decrypt anything, so it shows
+// which values changed to anybody without the private key.
+func (c *Cnf) Digests() []EnvVar {
+	env := make([]EnvVar, 0, len(c.root.Environment))
+	for _, envVar := range c.root.Environment {
+		var value string
+		switch {
+		case envVar.Value != nil:
+			value = *envVar.Value
+		case envVar.Template != "":
+			value = envVar.Template
+		default:
+			cipherText := envVar.EncryptedValue + envVar.EncryptedFile
+			for _, v := range envVar.EncryptedFor {
+				cipherText += v.EncryptedValue + v.EncryptedFile
+			}
+			sum := sha256.Sum256([]byte(cipherText))
+			value = "sha256:" + hex.EncodeToString(sum[:6])
+		}
+		env = append(env, EnvVar{
+			Name:  envVar.Name,
+			Value: value,
+			Plain: envVar.Value != nil,
+			File:  envVar.EncryptedFile != "" || (len(envVar.EncryptedFor) > 0 && envVar.EncryptedFor[0].EncryptedFile != ""),
+		})
+	}
+	return env
+}
+
+// byName indexes the environment by name. When a name repeats the last
+// entry wins.
+func (c *Cnf) byName() ([]string, map[string]interface{}) {
+	vars := make(map[string]interface{}, len(c.root.Environment))
+	for _, envVar := range c.root.Environment {
+		vars[envVar.Name] = envVar
+	}
+	return c.Names(), vars
+}
+
+// recipientsByName indexes the recipients by name.
+func (c *Cnf) recipientsByName() ([]string, map[string]interface{}) {
+	var names []string
+	recipients := make(map[string]interface{}, len(c.root.Recipients))
+	for _, r := range c.root.Recipients {
+		names = append(names, r.Name)
+		recipients[r.Name] = r
+	}
+	return names, recipients
+}
+
+// groupsByName indexes the groups by name.
+func (c *Cnf) groupsByName() ([]string, map[string]interface{}) {
+	var names []string
+	groups := make(map[string]interface{}, len(c.root.Groups))
+	for _, g := range c.root.Groups {
+		names = append(names, g.Name)
+		groups[g.Name] = g
+	}
+	return names, groups
+}
+
+// mergeByName does a three-way merge of entries matched by name, in the
+// order of ours followed by the entries only theirs has. An entry changed
+// differently on both sides is a conflict: ours is kept and its name is
+// returned.
+func mergeByName(base, ours, theirs func() ([]string, map[string]interface{})) ([]interface{}, []string) {
+	_, baseVals := base()
+	ourNames, ourVals := ours()
+	theirNames, theirVals := theirs()
+
+	names := ourNames
+	for _, name := range theirNames {
+		if _, ok := ourVals[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	var merged []interface{}
+	var conflicts []string
+	for _, name := range names {
+		b, inBase := baseVals[name]
+		o, inOurs := ourVals[name]
+		t, inTheirs := theirVals[name]
+
+		sameAsBase := func(v interface{}, in bool) bool {
+			return in == inBase && (!in || reflect.DeepEqual(v, b))
+		}
+
+		var v interface{}
+		var keep bool
+		switch {
+		case inOurs == inTheirs && (!inOurs || reflect.DeepEqual(o, t)):
+			v, keep = o, inOurs
+		case sameAsBase(o, inOurs):
+			v, keep = t, inTheirs
+		case sameAsBase(t, inTheirs):
+			v, keep = o, inOurs
+		default:
+			conflicts = append(conflicts, name)
+			if inOurs {
+				v, keep = o, true
+			} else {
+				v, keep = t, true
+			}
+		}
+		if keep {
+			merged = append(merged, v)
+		}
+	}
+	return merged, conflicts
+}
+
+// Merge does a three-way merge of the environments of ours and theirs,
+// which both descend from base. Variables, recipients and groups are
+// matched by name, so ones added on both sides merge cleanly. One changed
+// differently on both sides is a conflict: ours is kept and its name is
+// returned, prefixed with "recipient " or "group " for those. The result
+// uses the cipher of ours.
+func Merge(base, ours, theirs Cnf) (Cnf, []string) {
+	merged := Cnf{cipher: ours.cipher, root: ours.root}
+	if theirs.root.Version > merged.root.Version {
+		merged.root.Version = theirs.root.Version
+	}
+	if reflect.DeepEqual(ours.root.Includes, base.root.Includes) {
+		merged.root.Includes = theirs.root.Includes
+	}
+
+	var conflicts []string
+	vars, names := mergeByName(base.byName, ours.byName, theirs.byName)
+	merged.root.Environment = nil
+	for _, v := range vars {
+		merged.root.Environment = append(merged.root.Environment, v.(yamlEnvVar))
+	}
+	conflicts = append(conflicts, names...)
+
+	recipients, names := mergeByName(base.recipientsByName, ours.recipientsByName, theirs.recipientsByName)
+	merged.root.Recipients = nil
+	for _, r := range recipients {
+		merged.root.Recipients = append(merged.root.Recipients, r.(yamlRecipient))
+	}
+	for _, name := range names {
+		conflicts = append(conflicts, "recipient "+name)
+	}
+
+	groups, names := mergeByName(base.groupsByName, ours.groupsByName, theirs.groupsByName)
+	merged.root.Groups = nil
+	for _, g := range groups {
+		merged.root.Groups = append(merged.root.Groups, g.(yamlGroup))
+	}
+	for _, name := range names {
+		conflicts = append(conflicts, "group "+name)
+	}
+	return merged, conflicts
+}
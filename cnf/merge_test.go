@@ -0,0 +1,95 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"strings"
+	"testing"
+)
+
+func cnfWith(vars ...string) Cnf {
+	c := Cnf{root: yamlRoot{Version: 1}}
+	for i := 0; i+1 < len(vars); i += 2 {
+		c.root.Environment = append(c.root.Environment, yamlEnvVar{Name: vars[i], EncryptedValue: vars[i+1]})
+	}
+	return c
+}
+
+func envString(c Cnf) string {
+	var parts []string
+	for _, v := range c.root.Environment {
+		parts = append(parts, v.Name+"="+v.EncryptedValue)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMerge(t *testing.T) {
+	base := cnfWith("FOO", "1", "BAR", "1", "BAZ", "1")
+	ours := cnfWith("FOO", "2", "BAR", "1", "BAZ", "1", "OURS", "1")
+	theirs := cnfWith("FOO", "1", "BAZ", "2", "THEIRS", "1")
+
+	merged, conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", conflicts)
+	}
+	expected := "FOO=2 BAZ=2 OURS=1 THEIRS=1"
+	if envString(merged) != expected {
+		t.Fatalf("expected %s, got %s", expected, envString(merged))
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	base := cnfWith("FOO", "1")
+	ours := cnfWith("FOO", "2", "NEW", "a")
+	theirs := cnfWith("FOO", "3", "NEW", "b")
+
+	merged, conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 2 || conflicts[0] != "FOO" || conflicts[1] != "NEW" {
+		t.Fatalf("expected FOO and NEW to conflict, got %v", conflicts)
+	}
+	if envString(merged) != "FOO=2 NEW=a" {
+		t.Fatalf("conflicts should keep ours, got %s", envString(merged))
+	}
+}
+
+func TestMergeGroups(t *testing.T) {
+	base := cnfWith()
+	base.root.Recipients = []yamlRecipient{{Name: "alice", PublicKey: "a"}}
+	base.root.Groups = []yamlGroup{{Name: "ops", Recipients: []string{"alice"}}, {Name: "devs"}}
+	ours := cnfWith()
+	ours.root.Recipients = []yamlRecipient{{Name: "alice", PublicKey: "a2"}, {Name: "carol", PublicKey: "c"}}
+	ours.root.Groups = []yamlGroup{{Name: "ops", Recipients: []string{"alice"}}, {Name: "devs", Recipients: []string{"carol"}}}
+	theirs := cnfWith()
+	theirs.root.Recipients = []yamlRecipient{{Name: "alice", PublicKey: "a3"}, {Name: "bob", PublicKey: "b"}}
+	theirs.root.Groups = []yamlGroup{{Name: "ops", Recipients: []string{"alice", "bob"}}, {Name: "devs"}}
+
+	merged, conflicts := Merge(base, ours, theirs)
+	if len(conflicts) != 1 || conflicts[0] != "recipient alice" {
+		t.Fatalf("expected alice to conflict, got %v", conflicts)
+	}
+	recipients := merged.root.Recipients
+	if len(recipients) != 3 || recipients[0].PublicKey != "a2" || recipients[1].Name != "carol" || recipients[2].Name != "bob" {
+		t.Fatalf("unexpected recipients %v", recipients)
+	}
+	groups := merged.root.Groups
+	if len(groups) != 2 || strings.Join(groups[0].Recipients, ",") != "alice,bob" || strings.Join(groups[1].Recipients, ",") != "carol" {
+		t.Fatalf("both sides' members should be kept, got %v", groups)
+	}
+}
+
+func TestDigests(t *testing.T) {
+	c := cnfWith("FOO", "cipher1", "BAR", "cipher2")
+	digests := c.Digests()
+	if len(digests) != 2 || digests[0].Name != "FOO" {
+		t.Fatalf("unexpected digests: %v", digests)
+	}
+	if !strings.HasPrefix(digests[0].Value, "sha256:") || strings.Contains(digests[0].Value, "cipher1") {
+		t.Fatalf("digest should be a hash of the stored value: %s", digests[0].Value)
+	}
+	if digests[0].Value == digests[1].Value {
+		t.Fatal("different values should have different digests")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"fmt"
+	"time"
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+// timestamp returns the current time as stored in bens.yml.
+func timestamp() *time.Time {
+	t := now().UTC().Truncate(time.Second)
+	return &t
+}
+
+// Metadata describes a variable. Zero times are unset.
+type Metadata struct {
+	Description string
+	Owner       string
+	Created     time.Time
+	Rotated     time.Time
+	Expires     time.Time
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func (v yamlEnvVar) metadata() Metadata {
+	return Metadata{
+		Description: v.Description,
+		Owner:       v.Owner,
+		Created:     timeOrZero(v.Created),
+		Rotated:     timeOrZero(v.Rotated),
+		Expires:     timeOrZero(v.Expires),
+	}
+}
+
+func (v *yamlEnvVar) setMetadata(m Metadata) {
+	v.Description = m.Description
+	v.Owner = m.Owner
+	v.Created = timeOrNil(m.Created)
+	v.Rotated = timeOrNil(m.Rotated)
+	v.Expires = timeOrNil(m.Expires)
+}
+
+func (v yamlEnvVar) hasMetadata() bool {
+	return v.metadata() != Metadata{}
+}
+
+// LastChanged returns when the value was last rotated or, if it never was,
+// when it was created.
+func (m Metadata) LastChanged() time.Time {
+	if !m.Rotated.IsZero() {
+		return m.Rotated
+	}
+	return m.Created
+}
+
+// Metadata returns the metadata of the variable name.
+func (c *Cnf) Metadata(name string) (Metadata, error) {
+	for i := len(c.root.Environment) - 1; i >= 0; i-- {
+		if c.root.Environment[i].Name == name {
+			return c.root.Environment[i].metadata(), nil
+		}
+	}
+	return Metadata{}, fmt.Errorf("variable %s %w", name, ErrNotFound)
+}
+
+// UpdateMetadata calls update with the metadata of every variable named
+// name and stores the result.
+func (c *Cnf) UpdateMetadata(name string, update func(*Metadata)) error {
+	found := false
+	for i := range c.root.Environment {
+		v := &c.root.Environment[i]
+		if v.Name != name {
+			continue
+		}
+		m := v.metadata()
+		update(&m)
+		v.setMetadata(m)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("variable %s %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+// Set replaces the value of the variable name and records that it was
+// rotated, or adds the variable if there isn't one. Plaintext values,
+// templates and files stay plaintext values, templates and files.
+func (c *Cnf) Set(name, value string) error {
+	found := false
+	for i := range c.root.Environment {
+		v := &c.root.Environment[i]
+		if v.Name != name {
+			continue
+		}
+		if v.Template != "" || v.Interpolate {
+			if _, err := References(value); err != nil {
+				return fmt.Errorf("invalid template for %s: %v", name, err)
+			}
+		}
+		if v.Value != nil {
+			v.Value = &value
+		} else if len(v.Groups) > 0 {
+			file := len(v.EncryptedFor) > 0 && v.EncryptedFor[0].EncryptedFile != ""
+			values, err := c.encryptFor(v.Groups, []byte(value), file)
+			if err != nil {
+				return fmt.Errorf("couldn't encrypt %s: %w", name, err)
+			}
+			v.EncryptedFor = values
+		} else if v.Template != "" {
+			v.Template = value
+		} else if v.EncryptedFile != "" {
+			cipherText, err := c.cipher.EncryptBytes([]byte(value))
+			if err != nil {
+				return fmt.Errorf("couldn't encrypt %s: %v", name, err)
+			}
+			v.EncryptedFile = cipherText
+		} else {
+			cipherText, err := c.cipher.Encrypt(value)
+			if err != nil {
+				return fmt.Errorf("couldn't encrypt %s: %v", name, err)
+			}
+			v.EncryptedValue = cipherText
+		}
+		if v.EncryptedValue != "" || v.EncryptedFile != "" {
+			v.Key = c.fingerprint()
+		}
+		v.Rotated = timestamp()
+		found = true
+	}
+	if !found {
+		return c.Add(name, value)
+	}
+	return nil
+}
+
+// SetFile replaces the content of a file variable like Set. An encrypted
+// value becomes a file. Plaintext values and templates can't hold a file
+// and are an error. The variable is added if it doesn't exist yet.
+func (c *Cnf) SetFile(name string, content []byte) error {
+	found := false
+	for _, v := range c.root.Environment {
+		if v.Name != name {
+			continue
+		}
+		if v.Value != nil || v.Template != "" {
+			return fmt.Errorf("%s is a plaintext value or template and can't hold a file; remove it from the configuration file and add it again with --file", name)
+		}
+		found = true
+	}
+	if !found {
+		return c.AddFile(name, content)
+	}
+	for i := range c.root.Environment {
+		v := &c.root.Environment[i]
+		if v.Name != name {
+			continue
+		}
+		if len(v.Groups) > 0 {
+			values, err := c.encryptFor(v.Groups, content, true)
+			if err != nil {
+				return fmt.Errorf("couldn't encrypt %s: %w", name, err)
+			}
+			v.EncryptedFor = values
+		} else {
+			cipherText, err := c.cipher.EncryptBytes(content)
+			if err != nil {
+				return fmt.Errorf("couldn't encrypt %s: %v", name, err)
+			}
+			v.EncryptedValue = ""
+			v.EncryptedFile = cipherText
+			v.Key = c.fingerprint()
+		}
+		v.Rotated = timestamp()
+	}
+	return nil
+}
+
+// SetEncrypts reports whether Set needs the cipher to store name: when it
+// doesn't exist yet or one of its definitions is encrypted for the cipher's
+// key. Plaintext values, templates and values for groups don't need it.
+func (c *Cnf) SetEncrypts(name string) bool {
+	found := false
+	for _, v := range c.root.Environment {
+		if v.Name != name {
+			continue
+		}
+		if v.Value == nil && v.Template == "" && len(v.Groups) == 0 {
+			return true
+		}
+		found = true
+	}
+	return !found
+}
+
+type StaleVar struct {
+	Name     string
+	Reason   string
+	Metadata Metadata
+}
+
+// Stale returns the variables that expired or haven't changed for longer
+// than maxAge. A maxAge of zero only checks expiry. Variables without a
+// created or rotated time are stale when maxAge is set since their age is
+// unknown.
+func (c *Cnf) Stale(maxAge time.Duration) []StaleVar {
+	t := now()
+	var stale []StaleVar
+	for _, name := range c.Names() {
+		m, _ := c.Metadata(name)
+		var reason string
+		switch {
+		case !m.Expires.IsZero() && !m.Expires.After(t):
+			reason = fmt.Sprintf("expired %s", m.Expires.Format(time.RFC3339))
+		case maxAge == 0:
+		case m.LastChanged().IsZero():
+			reason = "no created or rotated time"
+		case t.Sub(m.LastChanged()) > maxAge:
+			reason = fmt.Sprintf("last changed %s", m.LastChanged().Format(time.RFC3339))
+		}
+		if reason != "" {
+			stale = append(stale, StaleVar{Name: name, Reason: reason, Metadata: m})
+		}
+	}
+	return stale
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeNow(t time.Time) func() {
+	original := now
+	now = func() time.Time { return t }
+	return func() { now = original }
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	dir, yamlFilePath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	created := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer fakeNow(created)()
+
+	cnf, err := New(yamlFilePath, MockCipher{})
+	if err != nil {
+		t.Fatalf("couldn't create Cnf with New: %v", err)
+	}
+	if err = cnf.Add("BAR", "bar"); err != nil {
+		t.Fatalf("couldn't add: %v", err)
+	}
+	expires := created.AddDate(1, 0, 0)
+	err = cnf.UpdateMetadata("BAR", func(m *Metadata) {
+		m.Description = "for tests"
+		m.Owner = "alice"
+		m.Expires = expires
+	})
+	if err != nil {
+		t.Fatalf("couldn't update metadata: %v", err)
+	}
+	if err = cnf.Save(yamlFilePath); err != nil {
+		t.Fatalf("couldn't save: %v", err)
+	}
+
+	cnf, err = New(yamlFilePath, MockCipher{})
+	if err != nil {
+		t.Fatalf("reloading Cnf with New failed: %v", err)
+	}
+	m, err := cnf.Metadata("BAR")
+	if err != nil {
+		t.Fatalf("couldn't get metadata: %v", err)
+	}
+	expected := Metadata{Description: "for tests", Owner: "alice", Created: created, Expires: expires}
+	if !m.Created.Equal(expected.Created) || !m.Expires.Equal(expected.Expires) ||
+		m.Description != expected.Description || m.Owner != expected.Owner || !m.Rotated.IsZero() {
+		t.Fatalf("expected %v, got %v", expected, m)
+	}
+	if cnf.FileVersion() != 2 {
+		t.Fatalf("files with metadata should be version 2; are %d", cnf.FileVersion())
+	}
+}
+
+func TestSetRotates(t *testing.T) {
+	dir, yamlFilePath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rotated := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer fakeNow(rotated)()
+
+	cnf, err := New(yamlFilePath, MockCipher{})
+	if err != nil {
+		t.Fatalf("couldn't create Cnf with New: %v", err)
+	}
+	if err = cnf.Set("FOO", "new"); err != nil {
+		t.Fatalf("couldn't set: %v", err)
+	}
+	environment, _ := cnf.DecryptEnvironment()
+	if len(environment) != 1 || environment[0].Value != "foonewbar" {
+		t.Fatalf("FOO should be replaced: %v", environment)
+	}
+	m, _ := cnf.Metadata("FOO")
+	if !m.Rotated.Equal(rotated) {
+		t.Fatalf("rotated should be %v; is %v", rotated, m.Rotated)
+	}
+
+	if err = cnf.Set("NEW", "new"); err != nil {
+		t.Fatalf("couldn't set: %v", err)
+	}
+	if len(cnf.Names()) != 2 {
+		t.Fatal("Set should add missing variables")
+	}
+}
+
+func TestSetEncrypts(t *testing.T) {
+	c := Cnf{cipher: MockCipher{}}
+	c.Add("SECRET", "s")
+	c.AddPlain("PORT", "8080")
+	c.AddTemplate("URL", "${PORT}", false)
+	for name, expected := range map[string]bool{"SECRET": true, "PORT": false, "URL": false, "NEW": true} {
+		if got := c.SetEncrypts(name); got != expected {
+			t.Fatalf("SetEncrypts(%s) should be %v", name, expected)
+		}
+	}
+
+	// Setting a plaintext value doesn't need the cipher.
+	c.SetCipher(nil)
+	if err := c.Set("PORT", "9090"); err != nil {
+		t.Fatalf("couldn't set a plaintext value without a cipher: %v", err)
+	}
+}
+
+func TestSetFile(t *testing.T) {
+	c := Cnf{cipher: MockCipher{}}
+	c.Add("SECRET", "s")
+	c.AddPlain("PORT", "8080")
+
+	// An encrypted value becomes a file, whatever its size.
+	content := strings.Repeat("x", 1000)
+	if err := c.SetFile("SECRET", []byte(content)); err != nil {
+		t.Fatalf("couldn't set file: %v", err)
+	}
+	if err := c.SetFile("NEW", []byte("new")); err != nil {
+		t.Fatalf("couldn't add file: %v", err)
+	}
+	if err := c.SetFile("PORT", []byte("9090")); err == nil {
+		t.Fatal("a plaintext value can't hold a file")
+	}
+	environment, err := c.DecryptEnvironment()
+	if err != nil {
+		t.Fatalf("couldn't decrypt: %v", err)
+	}
+	if !environment[0].File || environment[0].Value != "foo"+content+"bar" || environment[1].Value != "8080" || !environment[2].File {
+		t.Fatalf("unexpected environment %v", environment)
+	}
+}
+
+func TestStale(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := t0.AddDate(0, 0, -100)
+	recent := t0.AddDate(0, 0, -10)
+	defer fakeNow(t0)()
+
+	c := Cnf{root: yamlRoot{Environment: []yamlEnvVar{
+		{Name: "OLD", Created: &old},
+		{Name: "ROTATED", Created: &old, Rotated: &recent},
+		{Name: "EXPIRED", Created: &recent, Expires: &recent},
+		{Name: "UNKNOWN"},
+	}}}
+
+	names := func(stale []StaleVar) []string {
+		var n []string
+		for _, s := range stale {
+			n = append(n, s.Name)
+		}
+		return n
+	}
+
+	stale := names(c.Stale(90 * 24 * time.Hour))
+	if len(stale) != 3 || stale[0] != "OLD" || stale[1] != "EXPIRED" || stale[2] != "UNKNOWN" {
+		t.Fatalf("expected OLD, EXPIRED and UNKNOWN to be stale; got %v", stale)
+	}
+	stale = names(c.Stale(0))
+	if len(stale) != 1 || stale[0] != "EXPIRED" {
+		t.Fatalf("expected only EXPIRED without a max age; got %v", stale)
+	}
+}
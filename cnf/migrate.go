@@ -0,0 +1,171 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CurrentVersion is the newest version of the bens.yml format. New
+// migrates older files to it. Save writes the oldest version that can hold
+// the file's content so files that don't use newer features stay readable by
+// older versions of bens.
+//
+// Version 2 adds optional per variable metadata. Version 3 adds templates.
+// Version 4 adds plaintext values. Version 5 adds files. Version 6 adds
+// includes. Version 7 records the key each value was encrypted for. Version
+// 8 adds recipients and groups.
+const CurrentVersion = 8
+
+// A migration upgrades a document in place from the version it is
+// registered under to the next version. Migrations work on the generic
+// document because older formats needn't fit yamlRoot.
+type migration func(doc map[interface{}]interface{}) error
+
+var migrations = map[int]migration{
+	0: migrateFrom0,
+	1: addsFields,
+	2: addsFields,
+	3: addsFields,
+	4: addsFields,
+	5: addsFields,
+	6: addsFields,
+	7: addsFields,
+}
+
+// addsFields migrates to a version that only adds optional fields.
+func addsFields(_ map[interface{}]interface{}) error {
+	return nil
+}
+
+// migrateFrom0 upgrades files without a version field. They were written
+// before the version was checked and are otherwise identical to version 1.
+func migrateFrom0(_ map[interface{}]interface{}) error {
+	return nil
+}
+
+// parse decodes a bens.yml of any supported version, running the
+// migrations it needs, and returns it along with the version it was
+// written in. Unknown fields are rejected so a newer format isn't silently
+// misread.
+func parse(data []byte) (yamlRoot, int, error) {
+	var root yamlRoot
+	var doc map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return root, 0, fmt.Errorf("couldn't unmarshall yaml: %v", err)
+	}
+
+	version := 0
+	if v, ok := doc["version"]; ok {
+		if version, ok = v.(int); !ok {
+			return root, 0, fmt.Errorf("version must be a number; is %v", v)
+		}
+	}
+	if version < 0 || version > CurrentVersion {
+		return root, version, fmt.Errorf("%w %d; this bens supports versions up to %d", ErrUnsupportedVersion, version, CurrentVersion)
+	}
+
+	if version != CurrentVersion {
+		if doc == nil {
+			doc = make(map[interface{}]interface{})
+		}
+		for v := version; v < CurrentVersion; v++ {
+			m, ok := migrations[v]
+			if !ok {
+				return root, version, fmt.Errorf("no migration from version %d", v)
+			}
+			if err := m(doc); err != nil {
+				return root, version, fmt.Errorf("couldn't migrate from version %d: %v", v, err)
+			}
+			doc["version"] = v + 1
+		}
+		var err error
+		if data, err = yaml.Marshal(doc); err != nil {
+			return root, version, err
+		}
+	}
+
+	if err := yaml.UnmarshalStrict(data, &root); err != nil {
+		return root, version, fmt.Errorf("couldn't unmarshall yaml: %v", err)
+	}
+	return root, version, nil
+}
+
+// minimumVersion returns the oldest version that can represent root.
+func (r yamlRoot) minimumVersion() int {
+	version := 1
+	if len(r.Includes) > 0 {
+		version = 6
+	}
+	if len(r.Recipients) > 0 || len(r.Groups) > 0 {
+		version = 8
+	}
+	for _, envVar := range r.Environment {
+		if envVar.hasMetadata() && version < 2 {
+			version = 2
+		}
+		if (envVar.Template != "" || envVar.Interpolate) && version < 3 {
+			version = 3
+		}
+		if envVar.Value != nil && version < 4 {
+			version = 4
+		}
+		if envVar.EncryptedFile != "" && version < 5 {
+			version = 5
+		}
+		if envVar.Key != "" && version < 7 {
+			version = 7
+		}
+		if len(envVar.Groups) > 0 && version < 8 {
+			version = 8
+		}
+	}
+	return version
+}
+
+// SaveVersion returns the version Save writes, the oldest one that can hold
+// the content.
+func (c *Cnf) SaveVersion() int {
+	return c.root.minimumVersion()
+}
+
+// Migrate rewrites the file at yamlPath in the version Save writes for it,
+// keeping the original next to it as yamlPath.vN.bak where N is the version
+// it was written in. Files that are already in that version or a newer one
+// are left alone and the returned backup path is empty.
+func Migrate(yamlPath string) (c Cnf, backupPath string, err error) {
+	if c, err = New(yamlPath, nil); err != nil {
+		return c, "", err
+	}
+	if c.FileVersion() >= c.SaveVersion() {
+		return c, "", nil
+	}
+
+	original, err := ioutil.ReadFile(yamlPath)
+	if err != nil {
+		return c, "", err
+	}
+	backupPath = fmt.Sprintf("%s.v%d.bak", yamlPath, c.FileVersion())
+	backup, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return c, "", fmt.Errorf("backup %s already exists", backupPath)
+	}
+	if err != nil {
+		return c, "", fmt.Errorf("couldn't create backup: %v", err)
+	}
+	_, err = backup.Write(original)
+	if closeErr := backup.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return c, "", fmt.Errorf("couldn't write backup %s: %v", backupPath, err)
+	}
+	return c, backupPath, c.Save(yamlPath)
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package cnf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMigratesUnversionedFiles(t *testing.T) {
+	root, version, err := parse([]byte("environment:\n  - name: FOO\n    encryptedValue: foo\n"))
+	if err != nil {
+		t.Fatalf("couldn't parse: %v", err)
+	}
+	if version != 0 {
+		t.Fatalf("file version should be 0; is %d", version)
+	}
+	if root.Version != CurrentVersion {
+		t.Fatalf("version should be migrated to %d; is %d", CurrentVersion, root.Version)
+	}
+	if len(root.Environment) != 1 || root.Environment[0].Name != "FOO" {
+		t.Fatalf("environment wasn't kept: %v", root.Environment)
+	}
+}
+
+func TestParseRejectsNewerVersions(t *testing.T) {
+	_, _, err := parse([]byte("version: 12345\nenvironment: []\n"))
+	if err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Fatalf("expected an unsupported version error, got %v", err)
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	_, _, err := parse([]byte("version: 1\nenvironment:\n  - name: FOO\n    encryptedVal: foo\n"))
+	if err == nil {
+		t.Fatal("unknown fields should be rejected")
+	}
+}
+
+func TestParseRunsMigrations(t *testing.T) {
+	original := migrations
+	defer func() { migrations = original }()
+	migrations = make(map[int]migration)
+	for v, m := range original {
+		migrations[v] = m
+	}
+	migrations[0] = func(doc map[interface{}]interface{}) error {
+		doc["environment"] = []interface{}{
+			map[interface{}]interface{}{"name": "MIGRATED", "encryptedValue": "x"},
+		}
+		return nil
+	}
+
+	root, _, err := parse([]byte("{}"))
+	if err != nil {
+		t.Fatalf("couldn't parse: %v", err)
+	}
+	if len(root.Environment) != 1 || root.Environment[0].Name != "MIGRATED" {
+		t.Fatalf("migration didn't run: %v", root.Environment)
+	}
+}
+
+func TestMinimumVersion(t *testing.T) {
+	root := yamlRoot{Environment: []yamlEnvVar{{Name: "FOO"}}}
+	if v := root.minimumVersion(); v != 1 {
+		t.Fatalf("plain variables need version 1; got %d", v)
+	}
+	root.Environment = append(root.Environment, yamlEnvVar{Name: "BAR", Owner: "me"})
+	if v := root.minimumVersion(); v != 2 {
+		t.Fatalf("metadata needs version 2; got %d", v)
+	}
+}
+
+func TestUnsupportedVersionError(t *testing.T) {
+	_, _, err := parse([]byte("version: 12345\nenvironment: []\n"))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnf_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	yamlPath := filepath.Join(dir, "bens.yml")
+	original := []byte("environment:\n  - name: FOO\n    encryptedValue: foo\n")
+	if err = ioutil.WriteFile(yamlPath, original, 0600); err != nil {
+		t.Fatalf("couldn't write yaml: %v", err)
+	}
+
+	c, backupPath, err := Migrate(yamlPath)
+	if err != nil {
+		t.Fatalf("couldn't migrate: %v", err)
+	}
+	if backupPath != yamlPath+".v0.bak" {
+		t.Fatalf("unexpected backup path %q", backupPath)
+	}
+	if backup, _ := ioutil.ReadFile(backupPath); string(backup) != string(original) {
+		t.Fatalf("backup should hold the original; has %q", backup)
+	}
+	migrated, err := New(yamlPath, nil)
+	if err != nil {
+		t.Fatalf("couldn't load migrated yaml: %v", err)
+	}
+	if migrated.FileVersion() != c.SaveVersion() {
+		t.Fatalf("file should be version %d; is %d", c.SaveVersion(), migrated.FileVersion())
+	}
+
+	c, backupPath, err = Migrate(yamlPath)
+	if err != nil {
+		t.Fatalf("couldn't migrate again: %v", err)
+	}
+	if backupPath != "" {
+		t.Fatalf("migrating again shouldn't write a backup; wrote %s", backupPath)
+	}
+	if c.FileVersion() != migrated.FileVersion() {
+		t.Fatalf("migrating again shouldn't change the version; is %d", c.FileVersion())
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package env
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// EnvironmentEncoder writes a whole environment at once. Unlike
+// EnvironmentalVariableSerializer it can emit document level structure
+// (such as a JSON object) and can refuse values the format can't represent.
+type EnvironmentEncoder interface {
+	Encode(io.Writer, []Variable) error
+}
+
+func isMultiline(value string) bool {
+	return strings.ContainsAny(value, "\r\n")
+}
+
+// lineEncoder adapts an EnvironmentalVariableSerializer to an
+// EnvironmentEncoder by writing one variable per line.
+type lineEncoder struct {
+	serializer EnvironmentalVariableSerializer
+	multiline  bool
+}
+
+func (e lineEncoder) Encode(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		if !e.multiline && isMultiline(v.Value) {
+			return fmt.Errorf("can't encode multiline value of %s", v.Name)
+		}
+		if _, err := fmt.Fprintln(w, e.serializer.ToString(v.Name, v.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DotenvEncoder writes the dialect read by docker compose, godotenv and
+// python-dotenv. Values are single quoted when possible so nothing is
+// expanded. Values containing a single quote or a newline are double quoted
+// with \\, \", \$, \n and \r escapes.
+type DotenvEncoder struct{}
+
+var dotenvEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+func (_ DotenvEncoder) Encode(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		var line string
+		if strings.ContainsAny(v.Value, "'\r\n") {
+			line = fmt.Sprintf("%s=\"%s\"", v.Name, dotenvEscaper.Replace(v.Value))
+		} else {
+			line = fmt.Sprintf("%s='%s'", v.Name, v.Value)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DockerEncoder writes a file for docker's --env-file. Docker takes
+// everything after the first = literally, so there is no quoting and
+// multiline values can't be represented.
+type DockerEncoder struct{}
+
+func (_ DockerEncoder) Encode(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		if isMultiline(v.Value) {
+			return fmt.Errorf("docker env files can't contain the multiline value of %s", v.Name)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", v.Name, v.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SystemdEncoder writes a file for systemd's EnvironmentFile=. Values are
+// double quoted with \, ", ` and $ escaped. Newlines are kept literally,
+// which systemd accepts inside double quotes.
+type SystemdEncoder struct{}
+
+var systemdEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"`", "\\`",
+	`$`, `\$`,
+)
+
+func (_ SystemdEncoder) Encode(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", v.Name, systemdEscaper.Replace(v.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONEncoder writes a single JSON object mapping names to values. Names
+// keep the order of the environment; when a name repeats the last value
+// wins.
+type JSONEncoder struct{}
+
+func marshalJSONString(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func (_ JSONEncoder) Encode(w io.Writer, vars []Variable) error {
+	names := make([]string, 0, len(vars))
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		if _, ok := values[v.Name]; !ok {
+			names = append(names, v.Name)
+		}
+		values[v.Name] = v.Value
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		n, err := marshalJSONString(name)
+		if err != nil {
+			return err
+		}
+		v, err := marshalJSONString(values[name])
+		if err != nil {
+			return err
+		}
+		buf.WriteString("\n  ")
+		buf.Write(n)
+		buf.WriteString(": ")
+		buf.Write(v)
+	}
+	if len(names) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// GitHubEncoder writes the environment for a GitHub Actions step. Every
+// line of every value is masked with an ::add-mask:: workflow command
+// written to w so the runner redacts it from the logs, and the variables are
+// written to EnvFile, which should be opened for appending to $GITHUB_ENV.
+// Multiline values use the NAME<<DELIMITER heredoc syntax with a random
+// delimiter.
+type GitHubEncoder struct {
+	EnvFile io.Writer
+}
+
+var workflowCommandEscaper = strings.NewReplacer(
+	"%", "%25",
+	"\r", "%0D",
+	"\n", "%0A",
+)
+
+func newHeredocDelimiter(value string) (string, error) {
+	for {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		delimiter := "ghadelimiter_" + hex.EncodeToString(b)
+		if !strings.Contains(value, delimiter) {
+			return delimiter, nil
+		}
+	}
+}
+
+func (e GitHubEncoder) Encode(w io.Writer, vars []Variable) error {
+	envFile := e.EnvFile
+	if envFile == nil {
+		envFile = w
+	}
+	for _, v := range vars {
+		for _, line := range strings.FieldsFunc(v.Value, func(r rune) bool { return r == '\r' || r == '\n' }) {
+			if _, err := fmt.Fprintf(w, "::add-mask::%s\n", workflowCommandEscaper.Replace(line)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, v := range vars {
+		var err error
+		if isMultiline(v.Value) {
+			delimiter, derr := newHeredocDelimiter(v.Value)
+			if derr != nil {
+				return fmt.Errorf("couldn't generate delimiter for %s: %v", v.Name, derr)
+			}
+			_, err = fmt.Fprintf(envFile, "%s<<%s\n%s\n%s\n", v.Name, delimiter, v.Value, delimiter)
+		} else {
+			_, err = fmt.Fprintf(envFile, "%s=%s\n", v.Name, v.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GitLabEncoder writes a dotenv report artifact for GitLab CI. GitLab reads
+// values literally and doesn't support multiline values. There is no
+// directive to mask values at runtime, so variables that have to stay out of
+// job logs should also be masked in the project's CI/CD settings.
+type GitLabEncoder struct{}
+
+func (_ GitLabEncoder) Encode(w io.Writer, vars []Variable) error {
+	for _, v := range vars {
+		if isMultiline(v.Value) {
+			return fmt.Errorf("gitlab dotenv reports can't contain the multiline value of %s", v.Name)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", v.Name, v.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetEncoder(key string) (EnvironmentEncoder, error) {
+	switch key {
+	case "powershell":
+		return lineEncoder{serializer: PowerShellSerializer{}, multiline: true}, nil
+	case "shell":
+		return lineEncoder{serializer: ShellSerializer{}, multiline: true}, nil
+	case "cmd":
+		return lineEncoder{serializer: CMDSerializer{}}, nil
+	case "fish":
+		return lineEncoder{serializer: FishSerializer{}, multiline: true}, nil
+	case "dotenv":
+		return DotenvEncoder{}, nil
+	case "docker":
+		return DockerEncoder{}, nil
+	case "systemd":
+		return SystemdEncoder{}, nil
+	case "json":
+		return JSONEncoder{}, nil
+	case "github":
+		return GitHubEncoder{}, nil
+	case "gitlab":
+		return GitLabEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("no encoder for %s", key)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testVariables = []Variable{
+	{Name: "FOO", Value: "bar"},
+	{Name: "QUOTE", Value: `it's "$HOME" \o/`},
+	{Name: "MULTI", Value: "line1\nline2"},
+}
+
+func encode(t *testing.T, key string, vars []Variable) (string, error) {
+	e, err := GetEncoder(key)
+	if err != nil {
+		t.Fatalf("couldn't get %s encoder: %v", key, err)
+	}
+	var buf bytes.Buffer
+	err = e.Encode(&buf, vars)
+	return buf.String(), err
+}
+
+func TestDotenvEncoder(t *testing.T) {
+	v, err := encode(t, "dotenv", testVariables)
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+	expectedV := "FOO='bar'\n" +
+		`QUOTE="it's \"\$HOME\" \\o/"` + "\n" +
+		`MULTI="line1\nline2"` + "\n"
+	if v != expectedV {
+		t.Fatalf("expected %s, got %s", expectedV, v)
+	}
+}
+
+func TestDockerEncoder(t *testing.T) {
+	v, err := encode(t, "docker", testVariables[:2])
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+	expectedV := "FOO=bar\nQUOTE=it's \"$HOME\" \\o/\n"
+	if v != expectedV {
+		t.Fatalf("expected %s, got %s", expectedV, v)
+	}
+
+	if _, err := encode(t, "docker", testVariables); err == nil {
+		t.Fatal("multiline values should be rejected")
+	}
+}
+
+func TestSystemdEncoder(t *testing.T) {
+	v, err := encode(t, "systemd", testVariables)
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+	expectedV := "FOO=\"bar\"\n" +
+		`QUOTE="it's \"\$HOME\" \\o/"` + "\n" +
+		"MULTI=\"line1\nline2\"\n"
+	if v != expectedV {
+		t.Fatalf("expected %s, got %s", expectedV, v)
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	vars := append(testVariables, Variable{Name: "FOO", Value: "baz"})
+	v, err := encode(t, "json", vars)
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(v), &decoded); err != nil {
+		t.Fatalf("output isn't valid JSON: %v", err)
+	}
+	if len(decoded) != 3 {
+		t.Fatalf("expected 3 variables, got %d", len(decoded))
+	}
+	if decoded["FOO"] != "baz" {
+		t.Fatalf("last FOO should win; got %s", decoded["FOO"])
+	}
+	if decoded["MULTI"] != "line1\nline2" {
+		t.Fatalf("multiline value didn't round trip: %q", decoded["MULTI"])
+	}
+}
+
+func TestLineEncoders(t *testing.T) {
+	v, err := encode(t, "shell", testVariables[:1])
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+	if v != "export FOO=\"bar\"\n" {
+		t.Fatalf("unexpected shell output: %s", v)
+	}
+
+	if _, err := encode(t, "cmd", testVariables); err == nil {
+		t.Fatal("cmd should reject multiline values")
+	}
+}
+
+func TestGetEncoderUnknown(t *testing.T) {
+	if _, err := GetEncoder("nope"); err == nil {
+		t.Fatal("unknown encoders should return an error")
+	}
+}
+
+func TestGitHubEncoder(t *testing.T) {
+	var commands, envFile bytes.Buffer
+	err := GitHubEncoder{EnvFile: &envFile}.Encode(&commands, []Variable{
+		{Name: "FOO", Value: "100%"},
+		{Name: "MULTI", Value: "line1\nline2"},
+	})
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+
+	expectedCommands := "::add-mask::100%25\n::add-mask::line1\n::add-mask::line2\n"
+	if commands.String() != expectedCommands {
+		t.Fatalf("expected %s, got %s", expectedCommands, commands.String())
+	}
+
+	lines := strings.Split(envFile.String(), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("unexpected env file: %s", envFile.String())
+	}
+	if lines[0] != "FOO=100%" {
+		t.Fatalf("expected FOO=100%%, got %s", lines[0])
+	}
+	header := strings.SplitN(lines[1], "<<", 2)
+	if len(header) != 2 || header[0] != "MULTI" || !strings.HasPrefix(header[1], "ghadelimiter_") {
+		t.Fatalf("expected a heredoc for MULTI, got %s", lines[1])
+	}
+	if lines[2] != "line1" || lines[3] != "line2" || lines[4] != header[1] {
+		t.Fatalf("heredoc isn't terminated by its delimiter: %s", envFile.String())
+	}
+}
+
+func TestGitLabEncoder(t *testing.T) {
+	v, err := encode(t, "gitlab", testVariables[:1])
+	if err != nil {
+		t.Fatalf("couldn't encode: %v", err)
+	}
+	if v != "FOO=bar\n" {
+		t.Fatalf("unexpected gitlab output: %s", v)
+	}
+
+	if _, err := encode(t, "gitlab", testVariables); err == nil {
+		t.Fatal("multiline values should be rejected")
+	}
+}
@@ -5,30 +5,63 @@
 
 package env
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type EnvironmentalVariableSerializer interface {
 	ToString(string, string) string
 }
 
+// EnvironmentalVariableUnsetter produces the command that removes a
+// variable set by the matching serializer.
+type EnvironmentalVariableUnsetter interface {
+	UnsetString(string) string
+}
+
 type ShellSerializer struct{}
 
 func (_ ShellSerializer) ToString(name, value string) string {
 	return fmt.Sprintf("export %s=\"%s\"", name, value)
 }
 
+func (_ ShellSerializer) UnsetString(name string) string {
+	return fmt.Sprintf("unset %s", name)
+}
+
 type PowerShellSerializer struct{}
 
 func (_ PowerShellSerializer) ToString(name, value string) string {
 	return fmt.Sprintf("$env:%s = \"%s\"", name, value)
 }
 
+func (_ PowerShellSerializer) UnsetString(name string) string {
+	return fmt.Sprintf("Remove-Item Env:\\%s -ErrorAction SilentlyContinue", name)
+}
+
 type CMDSerializer struct{}
 
 func (_ CMDSerializer) ToString(name, value string) string {
 	return fmt.Sprintf("set \"%s=%s\"", name, value)
 }
 
+func (_ CMDSerializer) UnsetString(name string) string {
+	return fmt.Sprintf("set %s=", name)
+}
+
+type FishSerializer struct{}
+
+var fishEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func (_ FishSerializer) ToString(name, value string) string {
+	return fmt.Sprintf("set -gx %s '%s'", name, fishEscaper.Replace(value))
+}
+
+func (_ FishSerializer) UnsetString(name string) string {
+	return fmt.Sprintf("set -e %s", name)
+}
+
 func GetSerializer(key string) (EnvironmentalVariableSerializer, error) {
 	switch key {
 	case "powershell":
@@ -37,7 +70,24 @@ func GetSerializer(key string) (EnvironmentalVariableSerializer, error) {
 		return ShellSerializer{}, nil
 	case "cmd":
 		return CMDSerializer{}, nil
+	case "fish":
+		return FishSerializer{}, nil
 	default:
 		return nil, fmt.Errorf("no serializer for %s", key)
 	}
 }
+
+func GetUnsetter(key string) (EnvironmentalVariableUnsetter, error) {
+	switch key {
+	case "powershell":
+		return PowerShellSerializer{}, nil
+	case "shell":
+		return ShellSerializer{}, nil
+	case "cmd":
+		return CMDSerializer{}, nil
+	case "fish":
+		return FishSerializer{}, nil
+	default:
+		return nil, fmt.Errorf("can't unset variables for %s", key)
+	}
+}
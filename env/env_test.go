@@ -30,3 +30,33 @@ func TestCMDSerializer(t *testing.T) {
 		t.Fatalf("expected %s, got %s", expectedV, v)
 	}
 }
+
+func TestFishSerializer(t *testing.T) {
+	expectedV := `set -gx FOO 'it\'s \\o/'`
+	v := FishSerializer{}.ToString("FOO", `it's \o/`)
+	if v != expectedV {
+		t.Fatalf("expected %s, got %s", expectedV, v)
+	}
+}
+
+func TestUnsetters(t *testing.T) {
+	expected := map[string]string{
+		"shell":      "unset FOO",
+		"powershell": "Remove-Item Env:\\FOO -ErrorAction SilentlyContinue",
+		"cmd":        "set FOO=",
+		"fish":       "set -e FOO",
+	}
+	for key, expectedV := range expected {
+		u, err := GetUnsetter(key)
+		if err != nil {
+			t.Fatalf("couldn't get %s unsetter: %v", key, err)
+		}
+		if v := u.UnsetString("FOO"); v != expectedV {
+			t.Fatalf("expected %s, got %s", expectedV, v)
+		}
+	}
+
+	if _, err := GetUnsetter("json"); err == nil {
+		t.Fatal("json shouldn't have an unsetter")
+	}
+}
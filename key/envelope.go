@@ -0,0 +1,105 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Content larger than an RSA block is sealed in an envelope: a random
+// AES-256-GCM key encrypts the content and RSA-OAEP encrypts the AES key.
+// The envelope is
+//
+//	version (1 byte) | wrapped key length (2 bytes, big endian) | wrapped key | nonce | sealed content
+//
+// encoded as base64.
+const envelopeVersion = 1
+
+func (k Key) EncryptBytes(plainText []byte) (string, error) {
+	if k.publicKey == nil {
+		return "", fmt.Errorf("no public key associated")
+	}
+	contentKey := make([]byte, 32)
+	if _, err := rand.Read(contentKey); err != nil {
+		return "", err
+	}
+	defer zero(contentKey)
+	wrapped, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, k.publicKey, contentKey, []byte(""))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	envelope := make([]byte, 3, 3+len(wrapped)+len(nonce)+len(plainText)+gcm.Overhead())
+	envelope[0] = envelopeVersion
+	binary.BigEndian.PutUint16(envelope[1:], uint16(len(wrapped)))
+	envelope = append(envelope, wrapped...)
+	envelope = append(envelope, nonce...)
+	envelope = gcm.Seal(envelope, nonce, plainText, envelope[:3+len(wrapped)])
+	return base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+func (k Key) DecryptBytes(base64Envelope string) ([]byte, error) {
+	if !k.canDecrypt() {
+		return nil, ErrNoPrivateKey
+	}
+	envelope, err := base64.StdEncoding.DecodeString(strings.TrimSpace(base64Envelope))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTampered, err)
+	}
+	if len(envelope) < 3 || envelope[0] != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope: %w", ErrTampered)
+	}
+	wrappedLen := int(binary.BigEndian.Uint16(envelope[1:]))
+	if len(envelope) < 3+wrappedLen {
+		return nil, fmt.Errorf("truncated envelope: %w", ErrTampered)
+	}
+	header := envelope[:3+wrappedLen]
+	contentKey, err := k.decryptOAEP(header[3:])
+	if err != nil {
+		return nil, err
+	}
+	if err = mlock(contentKey); err != nil {
+		return nil, fmt.Errorf("couldn't lock key in memory: %v", err)
+	}
+	defer zero(contentKey)
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	rest := envelope[len(header):]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("truncated envelope: %w", ErrTampered)
+	}
+	plainText, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plainText, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+func TestEncryptBytes(t *testing.T) {
+	dir, passPath, priKeyPath, pubKeyPath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	k, err := New(passPath, priKeyPath, pubKeyPath)
+	if err != nil {
+		t.Fatalf("couldn't create key struct with New: %v", err)
+	}
+
+	// Much larger than an RSA block.
+	plainText := make([]byte, 64*1024)
+	if _, err = rand.Read(plainText); err != nil {
+		t.Fatalf("couldn't generate content: %v", err)
+	}
+	cipherText, err := k.EncryptBytes(plainText)
+	if err != nil {
+		t.Fatalf("couldn't EncryptBytes: %v", err)
+	}
+	decrypted, err := k.DecryptBytes(cipherText)
+	if err != nil {
+		t.Fatalf("couldn't DecryptBytes: %v", err)
+	}
+	if !bytes.Equal(decrypted, plainText) {
+		t.Fatal("decrypted content didn't match the original")
+	}
+
+	envelope, _ := base64.StdEncoding.DecodeString(cipherText)
+	envelope[len(envelope)-1] ^= 1
+	if _, err = k.DecryptBytes(base64.StdEncoding.EncodeToString(envelope)); err == nil {
+		t.Fatal("a modified envelope should be rejected")
+	}
+}
+
+func TestDecryptAnyCipherText(t *testing.T) {
+	dir, passPath, priKeyPath, pubKeyPath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	k, err := New(passPath, priKeyPath, pubKeyPath)
+	if err != nil {
+		t.Fatalf("couldn't create key struct with New: %v", err)
+	}
+	// Some ciphertexts start or end with bytes that look like whitespace.
+	for i := 0; i < 100; i++ {
+		cipherText, err := k.Encrypt("foo")
+		if err != nil {
+			t.Fatalf("couldn't Encrypt: %v", err)
+		}
+		if _, err = k.Decrypt(cipherText + "\n"); err != nil {
+			t.Fatalf("couldn't Decrypt %s: %v", cipherText, err)
+		}
+	}
+}
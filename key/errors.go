@@ -0,0 +1,25 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import "errors"
+
+// Errors returned by the key package, possibly wrapped. Test for them with
+// errors.Is.
+var (
+	// ErrNotFound is returned when a key or pass file doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrWrongPass is returned when the pass doesn't decrypt the private key.
+	ErrWrongPass = errors.New("wrong pass")
+	// ErrNoPrivateKey is returned when decrypting without a private key.
+	ErrNoPrivateKey = errors.New("no private key associated")
+	// ErrTampered is returned when a ciphertext can't be decrypted because it
+	// was modified, corrupted or encrypted with another key.
+	ErrTampered = errors.New("ciphertext was tampered with or encrypted with another key")
+	// ErrToken is returned when a PKCS#11 token fails for another reason than
+	// the ciphertext, such as being removed.
+	ErrToken = errors.New("token failed")
+)
@@ -0,0 +1,34 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// fingerprint returns the SHA-256 of the DER encoded SubjectPublicKeyInfo of
+// pub, the way ssh-keygen -l shows it.
+func fingerprint(pub *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Fingerprint identifies the key pair by its public key. It is the same for
+// a Key loaded from either half of the pair, so values can record the key
+// they were encrypted for.
+func (k Key) Fingerprint() string {
+	if k.publicKey == nil {
+		return ""
+	}
+	return fingerprint(k.publicKey)
+}
@@ -15,24 +15,30 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"os"
+	"strings"
 )
 
+// readFile reads the file at path, reporting a missing file as ErrNotFound.
+func readFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s %w", path, ErrNotFound)
+	}
+	return data, err
+}
+
 func readPassFile(passPath string) ([]byte, error) {
 	// Read the pass file
-	pass, err := ioutil.ReadFile(passPath)
+	pass, err := readFile(passPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	pass = bytes.TrimSpace(pass)
 	return pass, nil
 }
 
-func decodePemFile(path string) (pem.Block, error) {
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return pem.Block{}, err
-	}
+func decodePem(data []byte) (pem.Block, error) {
 	block, rest := pem.Decode(data)
 	if block == nil {
 		return pem.Block{}, fmt.Errorf("PEM file contain any blocks")
@@ -51,12 +57,7 @@ func zero(data []byte) {
 	}()
 }
 
-func decryptPrivateKey(path string, pass []byte) (*rsa.PrivateKey, error) {
-	// Read the PEM Privdate Key
-	block, err := decodePemFile(path)
-	if err != nil {
-		return nil, err
-	}
+func decryptPrivateKey(block pem.Block, pass []byte) (*rsa.PrivateKey, error) {
 	if block.Type != "RSA PRIVATE KEY" {
 		return nil, fmt.Errorf("block must be private key")
 	}
@@ -67,6 +68,9 @@ func decryptPrivateKey(path string, pass []byte) (*rsa.PrivateKey, error) {
 		return nil, fmt.Errorf("unencrypted private key used!")
 	}
 	der, err := x509.DecryptPEMBlock(&block, pass)
+	if err == x509.IncorrectPasswordError {
+		return nil, ErrWrongPass
+	}
 	if err != nil {
 		return nil, fmt.Errorf("decryption failed: %v", err)
 	}
@@ -89,9 +93,11 @@ func decryptPrivateKey(path string, pass []byte) (*rsa.PrivateKey, error) {
 		return nil, fmt.Errorf("couldn't lock key in memory: %v", err)
 	}
 	zero(bytes)
+	// A wrong pass isn't always detected while decrypting, but then the
+	// result doesn't parse.
 	pri, err := x509.ParsePKCS1PrivateKey(p.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't decode private key")
+		return nil, ErrWrongPass
 	}
 	zero(p.Bytes)
 
@@ -101,42 +107,76 @@ func decryptPrivateKey(path string, pass []byte) (*rsa.PrivateKey, error) {
 type Key struct {
 	privateKey *rsa.PrivateKey
 	publicKey  *rsa.PublicKey
+	// token decrypts in place of privateKey when the private key is kept
+	// on a hardware token.
+	token unwrapper
 }
 
+func parsePublicKey(block pem.Block) (*rsa.PublicKey, error) {
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("not a public key")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse public key: %v", err)
+	}
+	pub, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key must be rsa public")
+	}
+	return pub, nil
+}
+
+// NewWithPass reads the keys from files. The private key is only read when
+// pass isn't nil; pass is zeroed once it has been used.
 func NewWithPass(pass []byte, priKeyPath, pubKeyPath string) (Key, error) {
-	var privateKey *rsa.PrivateKey
+	var pri []byte
 	if pass != nil {
-		if err := mlock(pass); err != nil {
-			return Key{}, err
-		}
 		var err error
-		privateKey, err = decryptPrivateKey(priKeyPath, pass)
-		if err != nil {
+		if pri, err = readFile(priKeyPath); err != nil {
 			return Key{}, err
 		}
-		zero(pass)
+		defer zero(pass)
 	}
-
-	block, err := decodePemFile(pubKeyPath)
+	pub, err := readFile(pubKeyPath)
 	if err != nil {
-		return Key{}, fmt.Errorf("couldn't decode public key: %v", err)
+		return Key{}, fmt.Errorf("couldn't decode public key: %w", err)
 	}
-	if block.Type != "PUBLIC KEY" {
-		return Key{}, fmt.Errorf("not a public key: %s", pubKeyPath)
+	return FromPEM(pri, pub, pass)
+}
+
+// FromPEM creates a key from PEM encoded keys rather than files. The private
+// key is decrypted with pass. Either key can be nil: without the private key
+// the Key can only encrypt, and without the public key it is taken from the
+// private key.
+func FromPEM(pri, pub, pass []byte) (Key, error) {
+	var k Key
+	if pri != nil {
+		if err := mlock(pass); err != nil {
+			return Key{}, err
+		}
+		block, err := decodePem(pri)
+		if err != nil {
+			return Key{}, fmt.Errorf("couldn't decode private key: %w", err)
+		}
+		if k.privateKey, err = decryptPrivateKey(block, pass); err != nil {
+			return Key{}, err
+		}
+		k.publicKey = &k.privateKey.PublicKey
 	}
-	var pub *rsa.PublicKey
-	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return Key{}, fmt.Errorf("couldn't parse public key: %v", err)
+	if pub != nil {
+		block, err := decodePem(pub)
+		if err != nil {
+			return Key{}, fmt.Errorf("couldn't decode public key: %w", err)
+		}
+		if k.publicKey, err = parsePublicKey(block); err != nil {
+			return Key{}, err
+		}
 	}
-	switch publicKey := publicKey.(type) {
-	case *rsa.PublicKey:
-		pub = publicKey
-	default:
-		return Key{}, fmt.Errorf("key must be rsa public")
+	if k.publicKey == nil {
+		return Key{}, fmt.Errorf("no key given")
 	}
-
-	return Key{privateKey: privateKey, publicKey: pub}, nil
+	return k, nil
 }
 
 func New(passPath, priKeyPath, pubKeyPath string) (Key, error) {
@@ -162,19 +202,59 @@ func (k Key) Encrypt(plainText string) (string, error) {
 	return base64.StdEncoding.EncodeToString(cipherText), nil
 }
 
+// canDecrypt reports whether the key has a private key, in memory or on a
+// token.
+func (k Key) canDecrypt() bool {
+	return k.privateKey != nil || k.token != nil
+}
+
+// decryptOAEP decrypts RSA-OAEP with SHA-1, the way Encrypt encrypts. A
+// ciphertext that doesn't decrypt is reported as ErrTampered and a token
+// that fails otherwise as ErrToken.
+func (k Key) decryptOAEP(ciphertext []byte) ([]byte, error) {
+	if k.token != nil {
+		return k.token.unwrap(ciphertext)
+	}
+	if k.privateKey == nil {
+		return nil, ErrNoPrivateKey
+	}
+	plaintext, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, k.privateKey, ciphertext, []byte(""))
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plaintext, nil
+}
+
 func (k Key) Decrypt(base64CipherText string) (string, error) {
-	if k.publicKey == nil {
-		return "", fmt.Errorf("no private key associated")
+	if !k.canDecrypt() {
+		return "", ErrNoPrivateKey
 	}
-	ciphertext, err := base64.StdEncoding.DecodeString(base64CipherText)
+	// Trim the encoding rather than the decoded ciphertext, which may well
+	// start or end with bytes that look like whitespace.
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(base64CipherText))
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %v", ErrTampered, err)
 	}
-	ciphertext = bytes.TrimSpace(ciphertext)
-	b, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, k.privateKey, ciphertext, []byte(""))
+	b, err := k.decryptOAEP(ciphertext)
 	if err != nil {
 		return "", err
 	}
 	b = bytes.TrimSpace(b)
-	return string(b), err
+	return string(b), nil
+}
+
+// VerifyPair checks that the public key belongs to the private key, so
+// values encrypted with one can be decrypted with the other.
+func (k Key) VerifyPair() error {
+	if k.token != nil {
+		// The public key was read from the token.
+		return nil
+	}
+	if k.privateKey == nil {
+		return ErrNoPrivateKey
+	}
+	if k.publicKey == nil || k.publicKey.N.Cmp(k.privateKey.N) != 0 || k.publicKey.E != k.privateKey.E {
+		return fmt.Errorf("public key doesn't match private key")
+	}
+	return nil
 }
@@ -6,10 +6,15 @@
 package key
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -160,3 +165,149 @@ func TestNewWithEmptyPassFile(t *testing.T) {
 		t.Fatalf("new should handle empty pass by ignoring pass: %v", err)
 	}
 }
+
+func TestFromPEM(t *testing.T) {
+	pass := []byte("3gPyttqJ3luMmeok/npIiF+x/k61+B2r8gPZhUmvpFfk")
+	k, err := FromPEM(privateKeyFileContent, nil, pass)
+	if err != nil {
+		t.Fatalf("couldn't create key with FromPEM: %v", err)
+	}
+	fooBar, err := k.Decrypt(fooBarEncryptedContent)
+	if err != nil {
+		t.Fatalf("couldn't decrypt value with Decrypt: %v", err)
+	}
+	if fooBar != "foobar" {
+		t.Fatalf("%s != foobar", fooBar)
+	}
+
+	// The public key taken from the private key matches the public key file.
+	public, err := FromPEM(nil, publicKeyFileContent, nil)
+	if err != nil {
+		t.Fatalf("couldn't create public key with FromPEM: %v", err)
+	}
+	if public.publicKey.N.Cmp(k.publicKey.N) != 0 {
+		t.Fatal("public key doesn't match the private key")
+	}
+	if _, err = public.Decrypt(fooBarEncryptedContent); err == nil {
+		t.Fatal("a public key shouldn't decrypt")
+	}
+
+	if _, err = FromPEM(privateKeyFileContent, nil, []byte("wrong")); err == nil {
+		t.Fatal("a wrong pass should be rejected")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir, passPath, priKeyPath, pubKeyPath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err = New(passPath, filepath.Join(dir, "missing.key"), pubKeyPath); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing key; got %v", err)
+	}
+	if _, err = NewWithPass([]byte("wrong"), priKeyPath, pubKeyPath); !errors.Is(err, ErrWrongPass) {
+		t.Fatalf("expected ErrWrongPass; got %v", err)
+	}
+
+	public, err := New("", priKeyPath, pubKeyPath)
+	if err != nil {
+		t.Fatalf("couldn't load public key: %v", err)
+	}
+	if _, err = public.Decrypt(fooBarEncryptedContent); !errors.Is(err, ErrNoPrivateKey) {
+		t.Fatalf("expected ErrNoPrivateKey; got %v", err)
+	}
+
+	k, err := New(passPath, priKeyPath, pubKeyPath)
+	if err != nil {
+		t.Fatalf("couldn't load key: %v", err)
+	}
+	tampered := []byte(fooBarEncryptedContent)
+	tampered[10] ^= 1
+	if _, err = k.Decrypt(string(tampered)); !errors.Is(err, ErrTampered) {
+		t.Fatalf("expected ErrTampered; got %v", err)
+	}
+	if _, err = k.DecryptBytes(fooBarEncryptedContent); !errors.Is(err, ErrTampered) {
+		t.Fatalf("expected ErrTampered for a value that isn't an envelope; got %v", err)
+	}
+}
+
+// removedToken is a token that was unplugged.
+type removedToken struct{}
+
+func (removedToken) unwrap([]byte) ([]byte, error) {
+	return nil, fmt.Errorf("%w: device removed", ErrToken)
+}
+
+func (removedToken) close() error {
+	return nil
+}
+
+func TestTokenErrors(t *testing.T) {
+	dir, passPath, priKeyPath, pubKeyPath, err := writeTestFiles()
+	if err != nil {
+		t.Fatalf("couldn't write test files: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	k, err := New(passPath, priKeyPath, pubKeyPath)
+	if err != nil {
+		t.Fatalf("couldn't load key: %v", err)
+	}
+	envelope, err := k.EncryptBytes([]byte("foo"))
+	if err != nil {
+		t.Fatalf("couldn't encrypt: %v", err)
+	}
+
+	k = Key{publicKey: k.publicKey, token: removedToken{}}
+	if _, err = k.Decrypt(fooBarEncryptedContent); !errors.Is(err, ErrToken) || errors.Is(err, ErrTampered) {
+		t.Fatalf("expected ErrToken; got %v", err)
+	}
+	if _, err = k.DecryptBytes(envelope); !errors.Is(err, ErrToken) || errors.Is(err, ErrTampered) {
+		t.Fatalf("expected ErrToken for an envelope; got %v", err)
+	}
+}
+
+func TestVerifyPair(t *testing.T) {
+	pass := []byte("3gPyttqJ3luMmeok/npIiF+x/k61+B2r8gPZhUmvpFfk")
+	k, err := FromPEM(privateKeyFileContent, publicKeyFileContent, pass)
+	if err != nil {
+		t.Fatalf("couldn't create key with FromPEM: %v", err)
+	}
+	if err = k.VerifyPair(); err != nil {
+		t.Fatalf("matching keys should verify: %v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %v", err)
+	}
+	k.publicKey = &other.PublicKey
+	if err = k.VerifyPair(); err == nil {
+		t.Fatal("mismatched keys shouldn't verify")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	pass := []byte("3gPyttqJ3luMmeok/npIiF+x/k61+B2r8gPZhUmvpFfk")
+	pri, err := FromPEM(privateKeyFileContent, nil, pass)
+	if err != nil {
+		t.Fatalf("couldn't create key with FromPEM: %v", err)
+	}
+	pub, err := FromPEM(nil, publicKeyFileContent, nil)
+	if err != nil {
+		t.Fatalf("couldn't create key with FromPEM: %v", err)
+	}
+	if pri.Fingerprint() == "" || pri.Fingerprint() != pub.Fingerprint() {
+		t.Fatalf("both halves should have the same fingerprint; got %q and %q", pri.Fingerprint(), pub.Fingerprint())
+	}
+	if !strings.HasPrefix(pub.Fingerprint(), "SHA256:") {
+		t.Fatalf("fingerprint should start with SHA256:; is %q", pub.Fingerprint())
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %v", err)
+	}
+	if (Key{publicKey: &other.PublicKey}).Fingerprint() == pub.Fingerprint() {
+		t.Fatal("different keys should have different fingerprints")
+	}
+}
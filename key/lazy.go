@@ -0,0 +1,70 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+// Lazy is a key that is loaded the first time a value needs it, so that
+// only the keys of the values that are decrypted are loaded.
+type Lazy struct {
+	load func() (Key, error)
+	key  *Key
+	err  error
+}
+
+// NewLazy returns a key that calls load on first use. A failure is kept and
+// returned by every later use.
+func NewLazy(load func() (Key, error)) *Lazy {
+	return &Lazy{load: load}
+}
+
+// Load loads the key if it hasn't been yet and returns why it couldn't be.
+func (l *Lazy) Load() error {
+	if l.key == nil && l.err == nil {
+		k, err := l.load()
+		if err != nil {
+			l.err = err
+		} else {
+			l.key = &k
+		}
+	}
+	return l.err
+}
+
+func (l *Lazy) Decrypt(base64CipherText string) (string, error) {
+	if err := l.Load(); err != nil {
+		return "", err
+	}
+	return l.key.Decrypt(base64CipherText)
+}
+
+func (l *Lazy) DecryptBytes(envelope string) ([]byte, error) {
+	if err := l.Load(); err != nil {
+		return nil, err
+	}
+	return l.key.DecryptBytes(envelope)
+}
+
+func (l *Lazy) Encrypt(plainText string) (string, error) {
+	if err := l.Load(); err != nil {
+		return "", err
+	}
+	return l.key.Encrypt(plainText)
+}
+
+func (l *Lazy) EncryptBytes(content []byte) (string, error) {
+	if err := l.Load(); err != nil {
+		return "", err
+	}
+	return l.key.EncryptBytes(content)
+}
+
+// Fingerprint returns the fingerprint of the key, or "" if it can't be
+// loaded; Load tells why.
+func (l *Lazy) Fingerprint() string {
+	if l.Load() != nil {
+		return ""
+	}
+	return l.key.Fingerprint()
+}
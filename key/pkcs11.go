@@ -0,0 +1,144 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+//go:build pkcs11
+// +build pkcs11
+
+package key
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// token is a session with a PKCS#11 token that is logged in as the user.
+// Sessions can only run one operation at a time.
+type token struct {
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	object  pkcs11.ObjectHandle
+}
+
+func (t *token) unwrap(ciphertext []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	params := pkcs11.NewOAEPParams(pkcs11.CKM_SHA_1, pkcs11.CKG_MGF1_SHA1, pkcs11.CKZ_DATA_SPECIFIED, nil)
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_OAEP, params)}
+	if err := t.ctx.DecryptInit(t.session, mechanism, t.object); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrToken, err)
+	}
+	plaintext, err := t.ctx.Decrypt(t.session, ciphertext)
+	switch err {
+	case nil:
+		return plaintext, nil
+	case pkcs11.Error(pkcs11.CKR_ENCRYPTED_DATA_INVALID), pkcs11.Error(pkcs11.CKR_ENCRYPTED_DATA_LEN_RANGE):
+		return nil, ErrTampered
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrToken, err)
+	}
+}
+
+func (t *token) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ctx.Logout(t.session)
+	err := t.ctx.CloseSession(t.session)
+	t.ctx.Finalize()
+	t.ctx.Destroy()
+	return err
+}
+
+// findKey returns the RSA private key labeled label, or the only one on the
+// token if label is empty.
+func findKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+	}
+	if label != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	ctx.FindObjectsFinal(session)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case len(objects) == 0 && label != "":
+		return 0, fmt.Errorf("RSA private key %s %w", label, ErrNotFound)
+	case len(objects) == 0:
+		return 0, fmt.Errorf("RSA private key %w", ErrNotFound)
+	case len(objects) > 1:
+		return 0, fmt.Errorf("the token has several RSA private keys; choose one by label")
+	}
+	return objects[0], nil
+}
+
+// publicKey reads the public half of the private key object.
+func publicKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, object pkcs11.ObjectHandle) (*rsa.PublicKey, error) {
+	attributes, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	e := new(big.Int).SetBytes(attributes[1].Value)
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported public exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(attributes[0].Value), E: int(e.Int64())}, nil
+}
+
+// OpenPKCS11 opens the RSA private key on a PKCS#11 token. Decrypting
+// unwraps values with RSA-OAEP on the token, so the private key never
+// leaves it. The public key is read from the token as well. Close the key
+// once it isn't needed.
+func OpenPKCS11(options PKCS11Options) (Key, error) {
+	defer zero(options.PIN)
+	ctx := pkcs11.New(options.Module)
+	if ctx == nil {
+		return Key{}, fmt.Errorf("couldn't load PKCS#11 module %s", options.Module)
+	}
+	if err := ctx.Initialize(); err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return Key{}, fmt.Errorf("couldn't initialize PKCS#11 module: %v", err)
+	}
+	session, err := ctx.OpenSession(options.Slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return Key{}, fmt.Errorf("couldn't open slot %d: %v", options.Slot, err)
+	}
+	t := &token{ctx: ctx, session: session}
+
+	err = ctx.Login(session, pkcs11.CKU_USER, string(options.PIN))
+	if err == pkcs11.Error(pkcs11.CKR_PIN_INCORRECT) {
+		t.close()
+		return Key{}, ErrWrongPass
+	}
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		t.close()
+		return Key{}, fmt.Errorf("couldn't log in to token: %v", err)
+	}
+	if t.object, err = findKey(ctx, session, options.Label); err != nil {
+		t.close()
+		return Key{}, err
+	}
+	pub, err := publicKey(ctx, session, t.object)
+	if err != nil {
+		t.close()
+		return Key{}, fmt.Errorf("couldn't read public key from token: %v", err)
+	}
+	return Key{publicKey: pub, token: t}, nil
+}
@@ -0,0 +1,17 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+//go:build !pkcs11
+// +build !pkcs11
+
+package key
+
+import "fmt"
+
+// OpenPKCS11 needs bens built with the pkcs11 build tag, which needs cgo.
+func OpenPKCS11(options PKCS11Options) (Key, error) {
+	zero(options.PIN)
+	return Key{}, fmt.Errorf("bens was built without PKCS#11 support; build it with -tags pkcs11")
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+//go:build pkcs11
+// +build pkcs11
+
+package key
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/miekg/pkcs11"
+)
+
+// The PKCS#11 tests run against a token that was initialized, for example
+// with SoftHSM:
+//
+//	softhsm2-util --init-token --free --label bens --pin 1234 --so-pin 1234
+//	BENS_TEST_PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so BENS_TEST_PKCS11_PIN=1234 \
+//		go test -tags pkcs11 ./key
+//
+// They use the first slot with a token, whatever its number, and generate a
+// key on it that is destroyed again when the test finishes.
+
+// loginToken opens a read-write session on the first slot with a token and
+// logs in. done logs out and releases the module.
+func loginToken(t *testing.T, module, pin string) (ctx *pkcs11.Ctx, session pkcs11.SessionHandle, slot uint, done func()) {
+	ctx = pkcs11.New(module)
+	if ctx == nil {
+		t.Fatalf("couldn't load %s", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		t.Fatalf("couldn't initialize: %v", err)
+	}
+	done = func() {
+		ctx.Finalize()
+		ctx.Destroy()
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil || len(slots) == 0 {
+		done()
+		t.Fatalf("no token: %v", err)
+	}
+	if session, err = ctx.OpenSession(slots[0], pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION); err != nil {
+		done()
+		t.Fatalf("couldn't open session: %v", err)
+	}
+	if err = ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		ctx.CloseSession(session)
+		done()
+		t.Fatalf("couldn't log in: %v", err)
+	}
+	return ctx, session, slots[0], func() {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		done()
+	}
+}
+
+// generateTokenKey generates a key pair on the token and returns its slot
+// and the private key's label. Both halves are removed from the token when
+// the test finishes.
+func generateTokenKey(t *testing.T, module, pin string) (uint, string) {
+	ctx, session, slot, done := loginToken(t, module, pin)
+	defer done()
+
+	label := fmt.Sprintf("bens-test-%d", time.Now().UnixNano())
+	_, _, err := ctx.GenerateKeyPair(session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+			pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		})
+	if err != nil {
+		t.Fatalf("couldn't generate key pair: %v", err)
+	}
+	// The key under test closes the module when it is closed, which ends
+	// this session too, so the objects are removed in a session of their own.
+	t.Cleanup(func() { destroyTokenKey(t, module, pin, label) })
+	return slot, label
+}
+
+// destroyTokenKey removes the objects labeled label from the token.
+func destroyTokenKey(t *testing.T, module, pin, label string) {
+	ctx, session, _, done := loginToken(t, module, pin)
+	defer done()
+	if err := ctx.FindObjectsInit(session, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_LABEL, label)}); err != nil {
+		t.Errorf("couldn't find %s: %v", label, err)
+		return
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	ctx.FindObjectsFinal(session)
+	if err != nil {
+		t.Errorf("couldn't find %s: %v", label, err)
+		return
+	}
+	for _, object := range objects {
+		if err = ctx.DestroyObject(session, object); err != nil {
+			t.Errorf("couldn't destroy %s: %v", label, err)
+		}
+	}
+}
+
+func TestPKCS11(t *testing.T) {
+	module := os.Getenv("BENS_TEST_PKCS11_MODULE")
+	pin := os.Getenv("BENS_TEST_PKCS11_PIN")
+	if module == "" || pin == "" {
+		t.Skip("BENS_TEST_PKCS11_MODULE and BENS_TEST_PKCS11_PIN aren't set")
+	}
+	slot, label := generateTokenKey(t, module, pin)
+
+	k, err := OpenPKCS11(PKCS11Options{Module: module, Slot: slot, PIN: []byte(pin), Label: label})
+	if err != nil {
+		t.Fatalf("couldn't open token: %v", err)
+	}
+	defer k.Close()
+	if err = k.VerifyPair(); err != nil {
+		t.Fatalf("token key should verify: %v", err)
+	}
+
+	cipherText, err := k.Encrypt("foo")
+	if err != nil {
+		t.Fatalf("couldn't encrypt: %v", err)
+	}
+	if plainText, err := k.Decrypt(cipherText); err != nil || plainText != "foo" {
+		t.Fatalf("expected foo; got %q, %v", plainText, err)
+	}
+	content := bytes.Repeat([]byte{0, 1, 2, 0xff}, 4096)
+	envelope, err := k.EncryptBytes(content)
+	if err != nil {
+		t.Fatalf("couldn't encrypt bytes: %v", err)
+	}
+	if decrypted, err := k.DecryptBytes(envelope); err != nil || !bytes.Equal(decrypted, content) {
+		t.Fatalf("couldn't decrypt bytes: %v", err)
+	}
+
+	// Keys in memory encrypt for the token too.
+	pub := Key{publicKey: k.publicKey}
+	if cipherText, err = pub.Encrypt("bar"); err != nil {
+		t.Fatalf("couldn't encrypt: %v", err)
+	}
+	if plainText, err := k.Decrypt(cipherText); err != nil || plainText != "bar" {
+		t.Fatalf("expected bar; got %q, %v", plainText, err)
+	}
+	if _, err = k.Decrypt(base64Flip(cipherText)); !errors.Is(err, ErrTampered) {
+		t.Fatalf("expected ErrTampered, got %v", err)
+	}
+}
+
+func TestPKCS11Errors(t *testing.T) {
+	module := os.Getenv("BENS_TEST_PKCS11_MODULE")
+	pin := os.Getenv("BENS_TEST_PKCS11_PIN")
+	if module == "" || pin == "" {
+		t.Skip("BENS_TEST_PKCS11_MODULE and BENS_TEST_PKCS11_PIN aren't set")
+	}
+	slot, _ := generateTokenKey(t, module, pin)
+
+	_, err := OpenPKCS11(PKCS11Options{Module: module, Slot: slot, PIN: []byte(pin), Label: "bens-missing"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing label, got %v", err)
+	}
+	_, err = OpenPKCS11(PKCS11Options{Module: module, Slot: slot, PIN: []byte(pin + "wrong")})
+	if !errors.Is(err, ErrWrongPass) {
+		t.Fatalf("expected ErrWrongPass for a wrong PIN, got %v", err)
+	}
+}
+
+// base64Flip changes the first character of a base64 string.
+func base64Flip(s string) string {
+	b := []byte(s)
+	if b[0] == 'A' {
+		b[0] = 'B'
+	} else {
+		b[0] = 'A'
+	}
+	return string(b)
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Shamir's secret sharing over GF(2^8), with the AES polynomial
+// x^8 + x^4 + x^3 + x + 1. Every byte of the secret is the constant term of
+// its own random polynomial of degree threshold-1, and share x holds the
+// value of each polynomial at x.
+
+var expTable, logTable [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		// Multiply by the generator x+1.
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	expTable[255] = expTable[0]
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// splitSecret splits secret into n shares of which any threshold recover
+// it. Share i is evaluated at x = i+1.
+func splitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("need 2 <= threshold <= shares <= 255; have threshold %d and %d shares", threshold, n)
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+	coefficients := make([]byte, threshold)
+	for j, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's method at x = i+1.
+			x := byte(i + 1)
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+			shares[i][j] = y
+		}
+	}
+	zero(coefficients)
+	return shares, nil
+}
+
+// combineShares recovers the secret from shares evaluated at xs by Lagrange
+// interpolation at zero.
+func combineShares(xs []byte, shares [][]byte) ([]byte, error) {
+	if len(xs) == 0 {
+		return nil, fmt.Errorf("no shares")
+	}
+	for i := range xs {
+		if xs[i] == 0 || len(shares[i]) != len(shares[0]) {
+			return nil, fmt.Errorf("invalid share %d", xs[i])
+		}
+		for j := 0; j < i; j++ {
+			if xs[i] == xs[j] {
+				return nil, fmt.Errorf("share %d given twice", xs[i])
+			}
+		}
+	}
+	secret := make([]byte, len(shares[0]))
+	for i, xi := range xs {
+		// The Lagrange basis polynomial of xi at zero; subtraction is
+		// addition in GF(2^8).
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(xj, xj^xi))
+			}
+		}
+		for k, y := range shares[i] {
+			secret[k] ^= gfMul(y, basis)
+		}
+	}
+	return secret, nil
+}
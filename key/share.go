@@ -0,0 +1,136 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// shareTag starts every share and names the version of the format.
+const shareTag = "bens-share-1"
+
+// Share is one of the shares a private key is split into. Threshold shares
+// of the same key recover it; fewer reveal nothing about it.
+type Share struct {
+	Threshold int
+	Index     int
+	// Fingerprint is the fingerprint of the key the share belongs to.
+	Fingerprint string
+	data        []byte
+}
+
+// String encodes the share as a single line of text, which can be stored in
+// a file or typed in.
+func (s Share) String() string {
+	return fmt.Sprintf("%s %d %d %s %s", shareTag, s.Threshold, s.Index, s.Fingerprint,
+		base64.StdEncoding.EncodeToString(s.data))
+}
+
+// ParseShare decodes a share encoded by String.
+func ParseShare(text string) (Share, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 5 || fields[0] != shareTag {
+		return Share{}, fmt.Errorf("not a bens key share")
+	}
+	var s Share
+	var err error
+	if s.Threshold, err = strconv.Atoi(fields[1]); err != nil {
+		return Share{}, fmt.Errorf("invalid threshold: %v", err)
+	}
+	if s.Index, err = strconv.Atoi(fields[2]); err != nil || s.Index < 1 || s.Index > 255 {
+		return Share{}, fmt.Errorf("invalid index %s", fields[2])
+	}
+	s.Fingerprint = fields[3]
+	if s.data, err = base64.StdEncoding.DecodeString(fields[4]); err != nil {
+		return Share{}, fmt.Errorf("invalid share data: %v", err)
+	}
+	if err = mlock(s.data); err != nil {
+		return Share{}, fmt.Errorf("couldn't lock share in memory: %v", err)
+	}
+	return s, nil
+}
+
+// Split splits the private key into n shares of which any threshold
+// recover it with FromShares.
+func (k Key) Split(n, threshold int) ([]Share, error) {
+	if k.privateKey == nil {
+		return nil, ErrNoPrivateKey
+	}
+	der := x509.MarshalPKCS1PrivateKey(k.privateKey)
+	defer zero(der)
+	if err := mlock(der); err != nil {
+		return nil, fmt.Errorf("couldn't lock key in memory: %v", err)
+	}
+	data, err := splitSecret(der, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Threshold: threshold, Index: i + 1, Fingerprint: k.Fingerprint(), data: data[i]}
+	}
+	return shares, nil
+}
+
+// FromShares recovers a key from shares made by Split. The key is held in
+// locked memory like a key read from a file.
+func FromShares(shares []Share) (Key, error) {
+	if len(shares) == 0 {
+		return Key{}, fmt.Errorf("no shares given")
+	}
+	first := shares[0]
+	xs := make([]byte, len(shares))
+	data := make([][]byte, len(shares))
+	for i, s := range shares {
+		if s.Fingerprint != first.Fingerprint || s.Threshold != first.Threshold {
+			return Key{}, fmt.Errorf("share %d belongs to another key than share %d", s.Index, first.Index)
+		}
+		xs[i] = byte(s.Index)
+		data[i] = s.data
+	}
+	if len(shares) < first.Threshold {
+		return Key{}, fmt.Errorf("need %d shares; have %d", first.Threshold, len(shares))
+	}
+
+	der, err := combineShares(xs, data)
+	if err != nil {
+		return Key{}, err
+	}
+	defer zero(der)
+	if err = mlock(der); err != nil {
+		return Key{}, fmt.Errorf("couldn't lock key in memory: %v", err)
+	}
+	pri, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: shares don't combine into a key", ErrTampered)
+	}
+	k := Key{privateKey: pri, publicKey: &pri.PublicKey}
+	if k.Fingerprint() != first.Fingerprint {
+		return Key{}, fmt.Errorf("%w: shares combine into key %s rather than %s", ErrTampered, k.Fingerprint(), first.Fingerprint)
+	}
+	return k, nil
+}
+
+// MarshalPrivateKey returns the private key PEM encoded and encrypted with
+// pass, the way pri.key is stored.
+func (k Key) MarshalPrivateKey(pass []byte) ([]byte, error) {
+	if k.privateKey == nil {
+		return nil, ErrNoPrivateKey
+	}
+	der := x509.MarshalPKCS1PrivateKey(k.privateKey)
+	defer zero(der)
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", der, pass, x509.PEMCipherAES256)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
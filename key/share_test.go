@@ -0,0 +1,89 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSplitSecret(t *testing.T) {
+	secret := []byte("a secret of some length\x00\xff")
+	shares, err := splitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("couldn't split: %v", err)
+	}
+	for _, xs := range [][]byte{{1, 2, 3}, {5, 3, 1}, {2, 4, 5}, {1, 2, 3, 4, 5}} {
+		data := make([][]byte, len(xs))
+		for i, x := range xs {
+			data[i] = shares[x-1]
+		}
+		got, err := combineShares(xs, data)
+		if err != nil {
+			t.Fatalf("couldn't combine %v: %v", xs, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("shares %v combined into %q", xs, got)
+		}
+	}
+	got, _ := combineShares([]byte{1, 2}, shares[:2])
+	if bytes.Equal(got, secret) {
+		t.Fatal("fewer shares than the threshold shouldn't recover the secret")
+	}
+	if _, err = splitSecret(secret, 2, 3); err == nil {
+		t.Fatal("expected an error for a threshold above the number of shares")
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	pass := []byte("3gPyttqJ3luMmeok/npIiF+x/k61+B2r8gPZhUmvpFfk")
+	k, err := FromPEM(privateKeyFileContent, publicKeyFileContent, pass)
+	if err != nil {
+		t.Fatalf("couldn't create key with FromPEM: %v", err)
+	}
+	shares, err := k.Split(3, 2)
+	if err != nil {
+		t.Fatalf("couldn't split key: %v", err)
+	}
+
+	parsed := make([]Share, 0, 2)
+	for _, s := range []Share{shares[2], shares[0]} {
+		p, err := ParseShare(s.String() + "\n")
+		if err != nil {
+			t.Fatalf("couldn't parse share: %v", err)
+		}
+		parsed = append(parsed, p)
+	}
+	combined, err := FromShares(parsed)
+	if err != nil {
+		t.Fatalf("couldn't combine shares: %v", err)
+	}
+	cipherText, err := k.Encrypt("foo")
+	if err != nil {
+		t.Fatalf("couldn't encrypt: %v", err)
+	}
+	if plainText, err := combined.Decrypt(cipherText); err != nil || plainText != "foo" {
+		t.Fatalf("combined key should decrypt; got %q, %v", plainText, err)
+	}
+
+	if _, err = FromShares(parsed[:1]); err == nil {
+		t.Fatal("expected an error for too few shares")
+	}
+	parsed[1].data = append([]byte{}, parsed[1].data...)
+	parsed[1].data[0] ^= 1
+	if _, err = FromShares(parsed); !errors.Is(err, ErrTampered) {
+		t.Fatalf("expected ErrTampered for a modified share, got %v", err)
+	}
+
+	pem, err := combined.MarshalPrivateKey([]byte("new pass"))
+	if err != nil {
+		t.Fatalf("couldn't marshal key: %v", err)
+	}
+	if _, err = FromPEM(pem, nil, []byte("new pass")); err != nil {
+		t.Fatalf("couldn't read marshaled key: %v", err)
+	}
+}
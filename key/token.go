@@ -0,0 +1,36 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package key
+
+// unwrapper decrypts RSA-OAEP with SHA-1 with a private key that never
+// leaves a hardware token. unwrap returns ErrTampered for a ciphertext that
+// doesn't decrypt and wraps ErrToken for other failures.
+type unwrapper interface {
+	unwrap(ciphertext []byte) ([]byte, error)
+	close() error
+}
+
+// PKCS11Options selects a private key on a PKCS#11 token, such as an HSM, a
+// smartcard or SoftHSM.
+type PKCS11Options struct {
+	// Module is the path of the token's PKCS#11 library.
+	Module string
+	Slot   uint
+	// PIN logs in to the token as the user. It is zeroed once it has been
+	// used.
+	PIN []byte
+	// Label chooses among several RSA private keys on the token.
+	Label string
+}
+
+// Close releases the token a key opened with OpenPKCS11 holds. It does
+// nothing for other keys.
+func (k Key) Close() error {
+	if k.token == nil {
+		return nil
+	}
+	return k.token.close()
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package mask
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"sort"
+)
+
+// Encoding is one form a secret can take in output.
+type Encoding struct {
+	Form  string
+	Value string
+}
+
+// Encodings returns the forms of value that are masked: the value itself,
+// its standard and URL safe base64 encodings without padding, and its URL
+// query and path escapings. Forms that are identical are only returned once.
+func Encodings(value string) []Encoding {
+	if value == "" {
+		return nil
+	}
+	candidates := []Encoding{
+		{Form: "plain", Value: value},
+		{Form: "base64", Value: base64.RawStdEncoding.EncodeToString([]byte(value))},
+		{Form: "base64url", Value: base64.RawURLEncoding.EncodeToString([]byte(value))},
+		{Form: "url", Value: url.QueryEscape(value)},
+		{Form: "url", Value: url.PathEscape(value)},
+	}
+	encodings := make([]Encoding, 0, len(candidates))
+	seen := make(map[string]bool)
+	for _, e := range candidates {
+		if !seen[e.Value] {
+			seen[e.Value] = true
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+type pattern struct {
+	value       []byte
+	replacement []byte
+}
+
+// node is a state of an Aho-Corasick automaton over the patterns, which finds
+// every pattern in one pass over the output.
+type node struct {
+	next map[byte]int
+	fail int
+	// depth is the length of the input the node matches, the longest suffix
+	// of the output so far that could start a pattern.
+	depth int
+	// match is the longest pattern that ends at the node, or -1.
+	match int
+}
+
+// span is a part of the output to mask, at offsets from the start of the
+// output. Overlapping matches are merged into one span, named after the
+// longest of them, so no part of any secret is left.
+type span struct {
+	start, end int64
+	pattern    int
+}
+
+// Writer replaces every encoding of a secret written through it with
+// ***NAME*** before passing the output on. Output that ends with the start
+// of a secret is held back until the next write so a secret split across
+// writes is still caught; Flush writes whatever is held back.
+type Writer struct {
+	w        io.Writer
+	patterns []pattern
+	nodes    []node
+	// root is the root's transitions for every byte, since most output
+	// doesn't start a secret and is matched from the root.
+	root  [256]int
+	state int
+	// buf holds the output from offset on that hasn't been written yet, and
+	// spans the matches in it, in order.
+	buf    []byte
+	offset int64
+	spans  []span
+}
+
+// NewWriter masks the values of secrets, a map of names to values, in
+// everything written to w. Empty values are ignored.
+func NewWriter(w io.Writer, secrets map[string]string) *Writer {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m := &Writer{w: w, nodes: []node{{match: -1}}}
+	for _, name := range names {
+		replacement := []byte("***" + name + "***")
+		for _, e := range Encodings(secrets[name]) {
+			m.add(pattern{value: []byte(e.Value), replacement: replacement})
+		}
+	}
+	m.link()
+	return m
+}
+
+// add adds p to the automaton's trie.
+func (m *Writer) add(p pattern) {
+	n := 0
+	for _, c := range p.value {
+		next, ok := m.nodes[n].next[c]
+		if !ok {
+			next = len(m.nodes)
+			m.nodes = append(m.nodes, node{depth: m.nodes[n].depth + 1, match: -1})
+			if m.nodes[n].next == nil {
+				m.nodes[n].next = make(map[byte]int)
+			}
+			m.nodes[n].next[c] = next
+		}
+		n = next
+	}
+	if m.nodes[n].match < 0 {
+		m.nodes[n].match = len(m.patterns)
+		m.patterns = append(m.patterns, p)
+	}
+}
+
+// link sets the failure links, breadth first so that the links of shorter
+// nodes are set before they are followed, and lets every node report the
+// longest pattern that is a suffix of it.
+func (m *Writer) link() {
+	var queue []int
+	for c, child := range m.nodes[0].next {
+		m.root[c] = child
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if m.nodes[n].match < 0 {
+			m.nodes[n].match = m.nodes[m.nodes[n].fail].match
+		}
+		for c, child := range m.nodes[n].next {
+			m.nodes[child].fail = m.step(m.nodes[n].fail, c)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// step returns the node that follows n on c.
+func (m *Writer) step(n int, c byte) int {
+	for n != 0 {
+		if next, ok := m.nodes[n].next[c]; ok {
+			return next
+		}
+		n = m.nodes[n].fail
+	}
+	return m.root[c]
+}
+
+// mask adds s to the spans, merging it with the spans it overlaps. Matches
+// are found in the order of their ends, so s ends after every span.
+func (m *Writer) mask(s span) {
+	for len(m.spans) > 0 {
+		last := m.spans[len(m.spans)-1]
+		if last.end <= s.start {
+			break
+		}
+		m.spans = m.spans[:len(m.spans)-1]
+		if last.start < s.start {
+			s.start = last.start
+		}
+		if len(m.patterns[last.pattern].value) >= len(m.patterns[s.pattern].value) {
+			s.pattern = last.pattern
+		}
+	}
+	m.spans = append(m.spans, s)
+}
+
+// emit writes the output before until, masking the spans in it. A span that
+// reaches past until could still grow, so output is held back from its start.
+func (m *Writer) emit(until int64) error {
+	for _, s := range m.spans {
+		if s.start < until && s.end > until {
+			until = s.start
+		}
+	}
+	var out bytes.Buffer
+	pos, done := m.offset, 0
+	for _, s := range m.spans {
+		if s.end > until {
+			break
+		}
+		out.Write(m.buf[pos-m.offset : s.start-m.offset])
+		out.Write(m.patterns[s.pattern].replacement)
+		pos = s.end
+		done++
+	}
+	out.Write(m.buf[pos-m.offset : until-m.offset])
+	m.spans = append(m.spans[:0], m.spans[done:]...)
+	m.buf = append(m.buf[:0], m.buf[until-m.offset:]...)
+	m.offset = until
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := m.w.Write(out.Bytes())
+	return err
+}
+
+func (m *Writer) Write(p []byte) (int, error) {
+	if len(m.patterns) == 0 {
+		return m.w.Write(p)
+	}
+	end := m.offset + int64(len(m.buf))
+	for i, c := range p {
+		m.state = m.step(m.state, c)
+		if match := m.nodes[m.state].match; match >= 0 {
+			e := end + int64(i) + 1
+			m.mask(span{start: e - int64(len(m.patterns[match].value)), end: e, pattern: match})
+		}
+	}
+	m.buf = append(m.buf, p...)
+	// Only the output the automaton is in the middle of can still be part
+	// of a match.
+	if err := m.emit(end + int64(len(p)) - int64(m.nodes[m.state].depth)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush masks and writes any output held back waiting for more input.
+func (m *Writer) Flush() error {
+	m.state = 0
+	return m.emit(m.offset + int64(len(m.buf)))
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package mask
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var secrets = map[string]string{
+	"PASSWORD": "hunter2",
+	"TOKEN":    "a b&c",
+}
+
+func TestWriterMasksEncodings(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, secrets)
+	input := "pw=hunter2 b64=" + base64.StdEncoding.EncodeToString([]byte("hunter2")) +
+		" q=" + url.QueryEscape("a b&c") + " p=" + url.PathEscape("a b&c") + "\n"
+	if _, err := w.Write([]byte(input)); err != nil {
+		t.Fatalf("couldn't write: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("couldn't flush: %v", err)
+	}
+
+	expected := "pw=***PASSWORD*** b64=***PASSWORD***== q=***TOKEN*** p=***TOKEN***\n"
+	if out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestWriterMasksAcrossWrites(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, secrets)
+	input := strings.Repeat("some log output hunter2 ", 1000)
+	for i := 0; i < len(input); i++ {
+		if _, err := w.Write([]byte{input[i]}); err != nil {
+			t.Fatalf("couldn't write: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("couldn't flush: %v", err)
+	}
+
+	expected := strings.Repeat("some log output ***PASSWORD*** ", 1000)
+	if out.String() != expected {
+		t.Fatal("secret split across writes wasn't masked")
+	}
+}
+
+func TestWriterHoldsBackPartialMatches(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, secrets)
+	w.Write([]byte("before hunt"))
+	if strings.Contains(out.String(), "hunt") {
+		t.Fatalf("a possible secret prefix was written early: %q", out.String())
+	}
+	w.Write([]byte("ing after"))
+	w.Flush()
+	if out.String() != "before hunting after" {
+		t.Fatalf("expected unmasked output, got %q", out.String())
+	}
+}
+
+func TestWriterWithoutSecrets(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, map[string]string{"EMPTY": ""})
+	w.Write([]byte("hello"))
+	w.Flush()
+	if out.String() != "hello" {
+		t.Fatalf("expected output to pass through, got %q", out.String())
+	}
+}
+
+func TestWriterDoesNotHoldBackUnrelatedOutput(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, secrets)
+	w.Write([]byte("done\n"))
+	if out.String() != "done\n" {
+		t.Fatalf("output that can't start a secret should be written at once, got %q", out.String())
+	}
+}
+
+func TestWriterMasksOverlappingSecrets(t *testing.T) {
+	overlapping := map[string]string{
+		"LONG":  "correcthorse",
+		"SHORT": "xcorr",
+		"TAIL":  "horsebattery",
+		"INNER": "ecth",
+	}
+	for input, expected := range map[string]string{
+		"a xcorrecthorse b":         "a ***LONG*** b",
+		"a correcthorsebattery b":   "a ***LONG*** b",
+		"a correcthorse b":          "a ***LONG*** b",
+		"a xcorr b ecth c":          "a ***SHORT*** b ***INNER*** c",
+		"xcorrecthorsebattery":      "***LONG***",
+		"correcthorse correcthorse": "***LONG*** ***LONG***",
+	} {
+		var out bytes.Buffer
+		w := NewWriter(&out, overlapping)
+		for i := 0; i < len(input); i++ {
+			w.Write([]byte{input[i]})
+		}
+		w.Flush()
+		if out.String() != expected {
+			t.Fatalf("expected %q for %q, got %q", expected, input, out.String())
+		}
+	}
+}
+
+func BenchmarkWriter(b *testing.B) {
+	line := []byte(strings.Repeat("x", 120) + " hunter2\n")
+	w := NewWriter(ioutil.Discard, secrets)
+	b.SetBytes(int64(len(line)))
+	for i := 0; i < b.N; i++ {
+		w.Write(line)
+	}
+}
+
+func BenchmarkWriterManySecrets(b *testing.B) {
+	many := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		many[fmt.Sprintf("SECRET_%d", i)] = fmt.Sprintf("s3cret-value-%d", i)
+	}
+	line := []byte(strings.Repeat("x", 120) + " s3cret-value-42\n")
+	w := NewWriter(ioutil.Discard, many)
+	b.SetBytes(int64(len(line)))
+	for i := 0; i < b.N; i++ {
+		w.Write(line)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package render
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a text/template that is executed with the environment as its
+// data, so {{.NAME}} is the value of NAME. Referring to a variable that
+// isn't defined that way is an error. The helper functions are:
+//
+//	env "NAME"            the value of NAME, or "" if it isn't defined
+//	required "NAME"       the value of NAME, which must be defined and not empty
+//	default "x" VALUE     x if VALUE is empty, otherwise VALUE
+//	base64 VALUE          VALUE encoded as standard base64
+//	json VALUE            VALUE as a quoted JSON string
+type Template struct {
+	tmpl *template.Template
+}
+
+func funcs(environment map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"env": func(name string) string {
+			return environment[name]
+		},
+		"required": func(name string) (string, error) {
+			value, ok := environment[name]
+			if !ok {
+				return "", fmt.Errorf("%s isn't defined", name)
+			}
+			if value == "" {
+				return "", fmt.Errorf("%s is empty", name)
+			}
+			return value, nil
+		},
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"base64": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"json": func(value string) (string, error) {
+			b, err := json.Marshal(value)
+			return string(b), err
+		},
+	}
+}
+
+// Parse parses text as a template named name, which is used in error
+// messages.
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(funcs(nil)).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Execute writes the template to w with environment, a map of names to
+// values, as its data.
+func (t *Template) Execute(w io.Writer, environment map[string]string) error {
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return tmpl.Funcs(funcs(environment)).Execute(w, environment)
+}
+
+// Reference is a variable that a template requires.
+type Reference struct {
+	Name string
+	// Location is where the template refers to it, as name:line:column.
+	Location string
+}
+
+// References returns the variables that the template requires, as {{.NAME}}
+// or with required, in the order they appear. References made with env are
+// optional and aren't returned. Fields inside range and with refer to the
+// pipeline's value rather than the environment, so they are skipped too.
+func (t *Template) References() []Reference {
+	var refs []Reference
+	for _, tmpl := range t.tmpl.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		w := walker{tree: tmpl.Tree}
+		w.walk(tmpl.Tree.Root, true)
+		refs = append(refs, w.refs...)
+	}
+	return refs
+}
+
+// Missing returns the references to variables that aren't among names.
+func (t *Template) Missing(names []string) []Reference {
+	defined := make(map[string]bool, len(names))
+	for _, name := range names {
+		defined[name] = true
+	}
+	var missing []Reference
+	for _, ref := range t.References() {
+		if !defined[ref.Name] {
+			missing = append(missing, ref)
+		}
+	}
+	return missing
+}
+
+type walker struct {
+	tree *parse.Tree
+	refs []Reference
+}
+
+func (w *walker) add(node parse.Node, name string) {
+	location, _ := w.tree.ErrorContext(node)
+	w.refs = append(w.refs, Reference{Name: name, Location: location})
+}
+
+// walk records the references below node. root is set while dot is the
+// environment.
+func (w *walker) walk(node parse.Node, root bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, root)
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe, root)
+	case *parse.IfNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, root)
+		w.walk(n.ElseList, root)
+	case *parse.RangeNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, root)
+	case *parse.WithNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, root)
+	case *parse.TemplateNode:
+		w.walk(n.Pipe, root)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			w.walk(cmd, root)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 2 {
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "required" {
+				if s, ok := n.Args[1].(*parse.StringNode); ok {
+					w.add(s, s.Text)
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			w.walk(arg, root)
+		}
+	case *parse.FieldNode:
+		if root {
+			w.add(n, n.Ident[0])
+		}
+	case *parse.VariableNode:
+		// $ is the environment wherever it appears.
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			w.add(n, n.Ident[1])
+		}
+	}
+}
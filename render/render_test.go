@@ -0,0 +1,82 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	tmpl, err := Parse("config", `user={{.USER}}
+auth={{base64 .TOKEN}}
+json={"pass": {{json .PASS}}}
+port={{env "PORT" | default "8080"}}
+host={{required "HOST"}}
+`)
+	if err != nil {
+		t.Fatalf("couldn't parse: %v", err)
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, map[string]string{
+		"USER":  "alice",
+		"TOKEN": "t0k",
+		"PASS":  `a"b`,
+		"HOST":  "db",
+	})
+	if err != nil {
+		t.Fatalf("couldn't execute: %v", err)
+	}
+	expected := `user=alice
+auth=dDBr
+json={"pass": "a\"b"}
+port=8080
+host=db
+`
+	if out.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestExecuteMissing(t *testing.T) {
+	for _, text := range []string{`{{.MISSING}}`, `{{required "MISSING"}}`, `{{required "EMPTY"}}`} {
+		tmpl, err := Parse("config", text)
+		if err != nil {
+			t.Fatalf("couldn't parse %s: %v", text, err)
+		}
+		var out bytes.Buffer
+		if err = tmpl.Execute(&out, map[string]string{"EMPTY": ""}); err == nil {
+			t.Fatalf("%s should fail", text)
+		}
+	}
+}
+
+func TestMissing(t *testing.T) {
+	tmpl, err := Parse("config", `{{.A}}
+{{if .B}}{{required "C"}}{{end}}
+{{with .D}}{{.Inner}}{{$.E}}{{end}}
+{{env "OPTIONAL"}}
+`)
+	if err != nil {
+		t.Fatalf("couldn't parse: %v", err)
+	}
+	var names []string
+	for _, ref := range tmpl.References() {
+		names = append(names, ref.Name)
+	}
+	if strings.Join(names, " ") != "A B C D E" {
+		t.Fatalf("unexpected references: %v", names)
+	}
+
+	missing := tmpl.Missing([]string{"A", "B", "D"})
+	if len(missing) != 2 || missing[0].Name != "C" || missing[1].Name != "E" {
+		t.Fatalf("unexpected missing references: %v", missing)
+	}
+	if missing[0].Location != "config:2:20" {
+		t.Fatalf("unexpected location: %s", missing[0].Location)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 High Fidelity, Inc.
+//
+// Distributed under the Apache License, Version 2.0.
+// See the accompanying file LICENSE or http://www.apache.org/licenses/LICENSE-2.0.html
+
+package scan
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var secrets = map[string]string{
+	"PASSWORD": "hunter22",
+	"CERT":     "-----BEGIN-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA\n-----END-----",
+	"SHORT":    "abc",
+}
+
+func newTestMatcher(t *testing.T) *Matcher {
+	m, err := NewMatcher(secrets)
+	if err != nil {
+		t.Fatalf("couldn't create matcher: %v", err)
+	}
+	return m
+}
+
+func TestReader(t *testing.T) {
+	m := newTestMatcher(t)
+	input := "nothing here\n" +
+		"password: hunter22\n" +
+		"encoded: " + base64.StdEncoding.EncodeToString([]byte("hunter22")) + "\n" +
+		"MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA\n" +
+		"abc abc abc\n" +
+		"-----BEGIN-----\n"
+	findings, err := m.Reader(strings.NewReader(input), "config")
+	if err != nil {
+		t.Fatalf("couldn't scan: %v", err)
+	}
+	expected := []Finding{
+		{Path: "config", Line: 2, Name: "PASSWORD", Form: "plain"},
+		{Path: "config", Line: 3, Name: "PASSWORD", Form: "base64"},
+		{Path: "config", Line: 4, Name: "CERT", Form: "plain"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, findings)
+	}
+	for i := range expected {
+		if findings[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected[i], findings[i])
+		}
+	}
+
+	if len(m.Skipped) != 1 || m.Skipped[0] != "SHORT" {
+		t.Fatalf("SHORT should be skipped; skipped %v", m.Skipped)
+	}
+}
+
+func TestFindingDoesNotContainSecret(t *testing.T) {
+	m := newTestMatcher(t)
+	findings, _ := m.Reader(strings.NewReader("hunter22"), "f")
+	if len(findings) != 1 || strings.Contains(findings[0].String(), "hunter22") {
+		t.Fatalf("finding should name the secret without its value: %v", findings)
+	}
+}
+
+func TestTree(t *testing.T) {
+	m := newTestMatcher(t)
+	dir, err := ioutil.TempDir("", "scan_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "leak.txt"), []byte("a\nb hunter22 c\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "leak.txt"), []byte("hunter22\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "clean.txt"), []byte("hunter2\n"), 0644)
+
+	findings, err := m.Tree(dir)
+	if err != nil {
+		t.Fatalf("couldn't scan tree: %v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("expected one finding, got %v", findings)
+	}
+	if findings[0].Path != filepath.Join(dir, "sub", "leak.txt") || findings[0].Line != 2 {
+		t.Fatalf("unexpected finding: %v", findings[0])
+	}
+}
+
+func TestDiff(t *testing.T) {
+	m := newTestMatcher(t)
+	diff := `diff --git a/app.conf b/app.conf
+index 1111111..2222222 100644
+--- a/app.conf
++++ b/app.conf
+@@ -10,2 +10,3 @@ section
+ context
+-password = hunter22
++password = changeme
++token = hunter22
+diff --git a/notes.md b/notes.md
+--- a/notes.md
++++ b/notes.md
+@@ -1 +1,2 @@
+ # Notes
++++ hunter22
+`
+	findings, err := m.Diff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatalf("couldn't scan diff: %v", err)
+	}
+	expected := []Finding{
+		{Path: "app.conf", Line: 12, Name: "PASSWORD", Form: "plain"},
+		{Path: "notes.md", Line: 2, Name: "PASSWORD", Form: "plain"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, findings)
+	}
+	for i := range expected {
+		if findings[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected[i], findings[i])
+		}
+	}
+}